@@ -2,9 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/gkwa/hollowbeak/core"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var cacheCmd = &cobra.Command{
@@ -15,12 +23,333 @@ var cacheCmd = &cobra.Command{
 	},
 }
 
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached titles and failures",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, false, func(cache *core.Cache) error {
+			items, err := cache.Entries()
+			if err != nil {
+				return err
+			}
+
+			keys := make([]string, 0, len(items))
+			for key := range items {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			now := time.Now()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, key := range keys {
+				item := items[key]
+				value := item.Value
+				if value == "" {
+					value = "error: " + item.Error
+				}
+				expires := item.ExpiresAt.Format(time.DateOnly)
+				switch {
+				case item.Pinned:
+					expires = "pinned"
+				case item.Expired(now):
+					expires = "expired"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", key, value, expires)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var cacheGetCmd = &cobra.Command{
+	Use:   "get url",
+	Short: "Print the cached title of a URL",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, false, func(cache *core.Cache) error {
+			item, ok := cache.Lookup(cacheKey(args[0]))
+			if !ok {
+				return fmt.Errorf("%s is not cached", args[0])
+			}
+			if item.Value == "" {
+				return fmt.Errorf("%s failed: %s", args[0], item.Error)
+			}
+			fmt.Println(item.Value)
+			return nil
+		})
+	},
+}
+
+var cacheSetCmd = &cobra.Command{
+	Use:   "set url title",
+	Short: "Cache a title for a URL",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			return cache.Set(cacheKey(args[0]), args[1])
+		})
+	},
+}
+
+var cachePinCmd = &cobra.Command{
+	Use:   "pin url title",
+	Short: "Pin a title for a URL that never expires and is never replaced by fetched titles",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			return cache.Pin(cacheKey(args[0]), args[1])
+		})
+	},
+}
+
+var cacheUnpinCmd = &cobra.Command{
+	Use:   "unpin url",
+	Short: "Remove a pinned title so the URL is fetched again",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			unpinned, err := cache.Unpin(cacheKey(args[0]))
+			if err != nil {
+				return err
+			}
+			if !unpinned {
+				return fmt.Errorf("%s is not pinned", args[0])
+			}
+			return nil
+		})
+	},
+}
+
+var cacheDeleteCmd = &cobra.Command{
+	Use:   "delete url|pattern",
+	Short: "Delete a cached URL, or every URL matching a pattern with * and ? wildcards",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			pattern := args[0]
+			if !strings.ContainsAny(pattern, "*?") {
+				pattern = cacheKey(pattern)
+			}
+			removed, err := cache.Delete(pattern)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Deleted %d entries\n", removed)
+			return nil
+		})
+	},
+}
+
+var pruneOlderThan time.Duration
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove expired entries and, with --older-than, entries fetched before then",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			removed, err := cache.Prune(pruneOlderThan)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Pruned %d entries\n", removed)
+			return nil
+		})
+	},
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show cache size, expired entries and hit rate",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, false, func(cache *core.Cache) error {
+			stats, err := cache.Stats()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Entries:\t%d\n", stats.Entries)
+			fmt.Fprintf(w, "Failures:\t%d\n", stats.Negative)
+			fmt.Fprintf(w, "Pinned:\t%d\n", stats.Pinned)
+			fmt.Fprintf(w, "Expired:\t%d\n", stats.Expired)
+			fmt.Fprintf(w, "Size:\t%d bytes\n", stats.SizeBytes)
+			fmt.Fprintf(w, "Hits:\t%d\n", stats.Hits)
+			fmt.Fprintf(w, "Misses:\t%d\n", stats.Misses)
+			fmt.Fprintf(w, "Hit rate:\t%.1f%%\n", stats.HitRate()*100)
+			return w.Flush()
+		})
+	},
+}
+
+var cacheExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the cache as JSON to a file or stdout",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, false, func(cache *core.Cache) error {
+			if len(args) == 0 || args[0] == "-" {
+				return cache.Export(os.Stdout)
+			}
+			file, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			if err := cache.Export(file); err != nil {
+				file.Close()
+				return err
+			}
+			return file.Close()
+		})
+	},
+}
+
+var cacheImportCmd = &cobra.Command{
+	Use:   "import file",
+	Short: "Import cache entries from a JSON export, or - for stdin",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			var reader io.Reader = os.Stdin
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				reader = file
+			}
+			imported, err := cache.Import(reader)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported %d entries\n", imported)
+			return nil
+		})
+	},
+}
+
+var cacheSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Merge the cache with the one shared in a git repository and push the result",
+	Long: `Merge the cache with the one shared in a git repository and push the result.
+
+The repository is a git URL or a local path. Entries from the repository
+replace local ones fetched less recently, and every cached title except
+pinned ones is then committed back, so a new machine starts with the team's
+titles.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withCache(cmd, true, func(cache *core.Cache) error {
+			options, err := cacheSyncOptions()
+			if err != nil {
+				return err
+			}
+			result, err := core.SyncCache(cmd.Context(), LoggerFrom(cmd.Context()), cache, options)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported %d entries, exported %d entries\n", result.Imported, result.Exported)
+			switch {
+			case result.Pushed:
+				fmt.Println("Pushed changes to", options.Repository)
+			case result.Committed:
+				fmt.Println("Committed changes to", options.Repository)
+			default:
+				fmt.Println("Shared cache is up to date")
+			}
+			return nil
+		})
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(cacheCmd)
+	cacheSyncCmd.Flags().String("repository", "", "Git URL or local path of the repository the cache is shared through")
+	cacheSyncCmd.Flags().String("branch", "", "Branch to sync (default is the remote's default branch)")
+	cacheSyncCmd.Flags().String("file", core.DefaultCacheSyncFile, "Path of the shared cache within the repository")
+	for key, flag := range map[string]string{
+		"cache.sync.repository": "repository",
+		"cache.sync.branch":     "branch",
+		"cache.sync.file":       "file",
+	} {
+		if err := viper.BindPFlag(key, cacheSyncCmd.Flags().Lookup(flag)); err != nil {
+			fmt.Printf("Error binding %s flag: %v\n", flag, err)
+			os.Exit(1)
+		}
+	}
+	cachePruneCmd.Flags().DurationVar(&pruneOlderThan, "older-than", 0, "Also remove entries fetched longer ago than this (e.g. 720h)")
+	cacheCmd.AddCommand(
+		cacheListCmd,
+		cacheGetCmd,
+		cacheSetCmd,
+		cachePinCmd,
+		cacheUnpinCmd,
+		cacheDeleteCmd,
+		cachePruneCmd,
+		cacheStatsCmd,
+		cacheExportCmd,
+		cacheImportCmd,
+		cacheSyncCmd,
+	)
+}
+
+// cacheSyncOptions reads the cache sync settings, e.g.
+//
+//	cache:
+//	  sync:
+//	    repository: git@github.com:example/titles.git
+//	    branch: main
+func cacheSyncOptions() (core.CacheSyncOptions, error) {
+	repository := viper.GetString("cache.sync.repository")
+	if repository == "" {
+		return core.CacheSyncOptions{}, fmt.Errorf("no repository to sync with, set --repository or cache.sync.repository")
+	}
+	// Local paths may use ~; anything that exists locally is used as a path.
+	if expanded, err := homedir.Expand(repository); err == nil {
+		if _, err := os.Stat(expanded); err == nil {
+			repository = expanded
+		}
+	}
+
+	return core.CacheSyncOptions{
+		Repository: repository,
+		Branch:     viper.GetString("cache.sync.branch"),
+		File:       viper.GetString("cache.sync.file"),
+	}, nil
+}
+
+// withCache opens the cache, runs fn and, if save is set, saves the changes
+// fn made. Failures are logged and exit the process.
+func withCache(cmd *cobra.Command, save bool, fn func(cache *core.Cache) error) {
+	logger := LoggerFrom(cmd.Context())
+	cache, err := core.NewCache(logger, cacheOptions())
+	if err != nil {
+		logger.Error(err, "Failed to open cache")
+		os.Exit(1)
+	}
+
+	err = fn(cache)
+	if err == nil && save {
+		err = cache.CleanupAndSave()
+	}
+	if closeErr := cache.Close(); closeErr != nil {
+		logger.Error(closeErr, "Failed to close cache")
+	}
+	if err != nil {
+		logger.Error(err, "Cache command failed")
+		os.Exit(1)
+	}
+}
+
+// cacheKey returns the key url is cached under.
+func cacheKey(url string) string {
+	return core.NewURLCanonicalizer(cacheOptions().Canonicalize).Canonicalize(url)
 }
 
 func displaycachePath() {
-	cachePath, err := core.GetCachePath()
+	cachePath, err := core.GetCachePath(cacheOptions())
 	if err != nil {
 		fmt.Printf("Error getting cache path: %v\n", err)
 		return
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/gkwa/hollowbeak/core"
+	"github.com/spf13/cobra"
+)
+
+var slowThreshold time.Duration
+
+var checkCmd = &cobra.Command{
+	Use:   "check file",
+	Short: "Check the links in a file and report broken, redirected and slow ones",
+	Args:  cobra.ExactArgs(1),
+	Long: `Extract the URLs in a file the way file-url-titles does and probe each one
+with a HEAD request, falling back to GET when HEAD fails.
+
+Broken, redirected and slow links are listed, followed by a summary. Use
+--output json for a machine-readable report of every link. When --deadline
+passes, the links checked so far are reported and the rest are listed as
+unchecked. The command exits with status 1 if any link is broken or
+unchecked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := LoggerFrom(cmd.Context())
+		logger.V(1).Info("Debug: Entering check command Run function")
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			logger.Error(err, "Failed to open input file")
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		options, err := fetcherOptions()
+		if err != nil {
+			logger.Error(err, "Invalid fetcher configuration")
+			os.Exit(1)
+		}
+
+		ctx, cancel := fetchContext(cmd.Context())
+		defer cancel()
+
+		broken, err := core.CheckLinks(ctx, logger, file, outputFormat, slowThreshold, options)
+		if err != nil {
+			logger.Error(err, "Failed to check links")
+			os.Exit(1)
+		}
+		if broken > 0 {
+			logger.V(1).Info("Debug: Found broken links", "count", broken)
+			os.Exit(1)
+		}
+		logger.V(1).Info("Debug: Exiting check command Run function")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().DurationVar(&slowThreshold, "slow", core.DefaultSlowThreshold, "Report links that take longer than this to answer as slow")
+	checkCmd.Flags().IntVar(&concurrency, "concurrency", core.DefaultConcurrency, "Maximum number of URLs checked at the same time")
+	checkCmd.Flags().IntVar(&perHostConcurrency, "per-host-concurrency", core.DefaultPerHostConcurrency, "Maximum number of URLs checked at the same time on a single host")
+	checkCmd.Flags().DurationVar(&deadline, "deadline", 0, "Stop checking after this long and report the links checked so far (e.g. 30s, 2m)")
+}
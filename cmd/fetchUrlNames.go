@@ -30,12 +30,23 @@ to quickly create a Cobra application.`,
 		content := strings.Join(args, "\n")
 		buffer.WriteString(content)
 
+		options, err := fetcherOptions()
+		if err != nil {
+			logger.Error(err, "Invalid fetcher configuration")
+			os.Exit(1)
+		}
+
+		ctx, cancel := fetchContext(cmd.Context())
+		defer cancel()
+
 		if err := core.FetchURLTitles(
+			ctx,
 			logger,
 			buffer,
 			outputFormat,
 			fetcherTypes,
 			noCache,
+			options,
 		); err != nil {
 			logger.Error(err, "Failed to execute Hello function")
 			os.Exit(1)
@@ -1,16 +1,27 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/gkwa/hollowbeak/core"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
-	outputFormat string
-	fetcherTypes []string
-	noCache      bool
+	outputFormat       string
+	fetcherTypes       []string
+	noCache            bool
+	concurrency        int
+	perHostConcurrency int
+	deadline           time.Duration
+	titleSources       []string
+	maxBodyBytes       int64
 )
 
 var fileUrlTitlesCmd = &cobra.Command{
@@ -31,12 +42,23 @@ var fileUrlTitlesCmd = &cobra.Command{
 		}
 		defer file.Close()
 
+		options, err := fetcherOptions()
+		if err != nil {
+			logger.Error(err, "Invalid fetcher configuration")
+			os.Exit(1)
+		}
+
+		ctx, cancel := fetchContext(cmd.Context())
+		defer cancel()
+
 		if err := core.FetchURLTitles(
+			ctx,
 			logger,
 			file,
 			outputFormat,
 			fetcherTypes,
 			noCache,
+			options,
 		); err != nil {
 			logger.Error(err, "Failed to execute Hello function")
 			os.Exit(1)
@@ -47,6 +69,127 @@ var fileUrlTitlesCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(fileUrlTitlesCmd)
-	fileUrlTitlesCmd.Flags().StringSliceVar(&fetcherTypes, "fetcher", []string{"sql", "colly", "http"}, "Title fetcher types: 'http', 'colly', or 'sql'. Can be specified multiple times.")
+	fileUrlTitlesCmd.Flags().StringSliceVar(&fetcherTypes, "fetcher", []string{"sql", "colly", "http"}, "Title fetcher types: 'http', 'colly', 'sql', or 'firefox'. Can be specified multiple times.")
 	fileUrlTitlesCmd.Flags().BoolVar(&noCache, "no-cache", false, "Skip cache for this run")
+	fileUrlTitlesCmd.Flags().IntVar(&concurrency, "concurrency", core.DefaultConcurrency, "Maximum number of URLs fetched at the same time")
+	fileUrlTitlesCmd.Flags().IntVar(&perHostConcurrency, "per-host-concurrency", core.DefaultPerHostConcurrency, "Maximum number of URLs fetched at the same time from a single host")
+	fileUrlTitlesCmd.Flags().StringSliceVar(&titleSources, "title-source", core.DefaultTitleSources, "Page metadata used for titles, in order of precedence: 'og:title', 'twitter:title', 'json-ld', 'title', 'og:site_name'")
+	fileUrlTitlesCmd.Flags().Int64Var(&maxBodyBytes, "max-body-bytes", core.DefaultMaxBodyBytes, "Maximum number of bytes read from each response body")
+	fileUrlTitlesCmd.Flags().DurationVar(&deadline, "deadline", 0, "Stop fetching after this long and output the titles resolved so far (e.g. 30s, 2m)")
+	fileUrlTitlesCmd.Flags().Int("retry-attempts", core.DefaultRetryMaxAttempts, "Maximum attempts per URL, including the first, for transient failures")
+	fileUrlTitlesCmd.Flags().Duration("retry-backoff", core.DefaultRetryInitialBackoff, "Delay before the first retry; doubled with jitter for each further retry")
+	fileUrlTitlesCmd.Flags().Duration("retry-max-backoff", core.DefaultRetryMaxBackoff, "Maximum delay between retries, including delays requested by Retry-After")
+	fileUrlTitlesCmd.Flags().Duration("negative-cache-ttl", core.DefaultNegativeCacheTTL, "How long failed lookups are cached before the URL is fetched again")
+	fileUrlTitlesCmd.Flags().Bool("retry-failed", false, "Ignore cached failures and fetch those URLs again")
+	fileUrlTitlesCmd.Flags().Bool("canonical-urls", false, "Write URLs to the output in canonical form, e.g. without fragments and tracking parameters")
+	fileUrlTitlesCmd.Flags().StringSlice("history-file", nil, "Chromium History database to read for the 'sql' fetcher (default: discover all browsers and profiles). Can be specified multiple times.")
+
+	for key, flag := range map[string]string{
+		"history-files":         "history-file",
+		"retry.max-attempts":    "retry-attempts",
+		"retry.initial-backoff": "retry-backoff",
+		"retry.max-backoff":     "retry-max-backoff",
+		"cache.negative-ttl":    "negative-cache-ttl",
+		"cache.retry-failed":    "retry-failed",
+		"canonicalize.output":   "canonical-urls",
+	} {
+		if err := viper.BindPFlag(key, fileUrlTitlesCmd.Flags().Lookup(flag)); err != nil {
+			fmt.Printf("Error binding %s flag: %v\n", flag, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func fetcherOptions() (core.FetcherOptions, error) {
+	retries := core.RetryPolicies{
+		Default: core.RetryPolicy{
+			MaxAttempts:    viper.GetInt("retry.max-attempts"),
+			InitialBackoff: viper.GetDuration("retry.initial-backoff"),
+			MaxBackoff:     viper.GetDuration("retry.max-backoff"),
+		},
+	}
+	// Per-domain policies are only configurable in the config file, e.g.
+	//
+	//	retry:
+	//	  domains:
+	//	    github.com:
+	//	      max-attempts: 5
+	//	      max-backoff: 1m
+	if err := viper.UnmarshalKey("retry.domains", &retries.PerDomain); err != nil {
+		return core.FetcherOptions{}, fmt.Errorf("failed to read retry.domains: %w", err)
+	}
+
+	return core.FetcherOptions{
+		HistoryFiles: viper.GetStringSlice("history-files"),
+		Concurrency: core.ConcurrencyLimits{
+			Global:  concurrency,
+			PerHost: perHostConcurrency,
+		},
+		Retries:      retries,
+		MaxBodyBytes: maxBodyBytes,
+		TitleSources: titleSources,
+		Cache:        cacheOptions(),
+	}, nil
+}
+
+// cacheOptions reads the cache settings. The backend and overrides file are
+// only configurable in the config file, e.g.
+//
+//	cache:
+//	  backend: json
+//	  file: ./titles.json
+//	  negative-ttl: 1h
+//	  overrides-file: ~/notes/titles.yaml
+//	  server-ttl: true
+//	  min-ttl: 72h
+func cacheOptions() core.CacheOptions {
+	overridesFile, err := homedir.Expand(viper.GetString("cache.overrides-file"))
+	if err != nil || overridesFile == "" {
+		overridesFile, _ = core.GetOverridesPath()
+	}
+	cacheFile, err := homedir.Expand(viper.GetString("cache.file"))
+	if err != nil {
+		cacheFile = viper.GetString("cache.file")
+	}
+
+	// URLs are normalized into cache keys unless disabled, e.g.
+	//
+	//	canonicalize:
+	//	  keep-trailing-slash: true
+	//	  tracking-parameters: [utm_*, ref]
+	canonicalize := core.CanonicalizeOptions{
+		Disabled:          viper.GetBool("canonicalize.disabled"),
+		KeepTrailingSlash: viper.GetBool("canonicalize.keep-trailing-slash"),
+		KeepFragment:      viper.GetBool("canonicalize.keep-fragment"),
+		RewriteOutput:     viper.GetBool("canonicalize.output"),
+	}
+	if viper.IsSet("canonicalize.tracking-parameters") {
+		canonicalize.TrackingParameters = append([]string{}, viper.GetStringSlice("canonicalize.tracking-parameters")...)
+	}
+
+	return core.CacheOptions{
+		Backend:       viper.GetString("cache.backend"),
+		NegativeTTL:   viper.GetDuration("cache.negative-ttl"),
+		RetryFailed:   viper.GetBool("cache.retry-failed"),
+		ServerTTL:     viper.GetBool("cache.server-ttl"),
+		MinTTL:        viper.GetDuration("cache.min-ttl"),
+		OverridesFile: overridesFile,
+		File:          cacheFile,
+		Canonicalize:  canonicalize,
+	}
+}
+
+// fetchContext returns a context that is cancelled on interrupt and, when
+// --deadline is set, once the deadline passes.
+func fetchContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+	if deadline <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
 }
@@ -46,10 +46,11 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "markdown", "Output format: 'markdown', 'html' or 'space'")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "markdown", "Output format: 'markdown', 'html', 'space' or 'json'")
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.hollowbeak.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose mode")
 	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "", "json or text (default is text)")
+	rootCmd.PersistentFlags().String("cache-file", "", "Title cache file, e.g. a per-project cache; '.json' files use the JSON backend (default is in the XDG cache directory)")
 
 	if err := viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose")); err != nil {
 		fmt.Printf("Error binding verbose flag: %v\n", err)
@@ -59,6 +60,10 @@ func init() {
 		fmt.Printf("Error binding log-format flag: %v\n", err)
 		os.Exit(1)
 	}
+	if err := viper.BindPFlag("cache.file", rootCmd.PersistentFlags().Lookup("cache-file")); err != nil {
+		fmt.Printf("Error binding cache-file flag: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 func initConfig() {
@@ -1,10 +1,16 @@
 package core
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/adrg/xdg"
@@ -12,124 +18,834 @@ import (
 )
 
 const (
-	cacheFileName = "hollowbeak/data.json"
+	cacheFileName       = "hollowbeak/cache.db"
+	legacyCacheFileName = "hollowbeak/data.json"
 )
 
+const (
+	CacheBackendSQLite = "sqlite"
+	CacheBackendJSON   = "json"
+)
+
+// DefaultCacheTTL is how long a fetched title is cached.
+const DefaultCacheTTL = 6 * 30 * 24 * time.Hour
+
+// DefaultNegativeCacheTTL is how long a failed lookup is remembered before the
+// URL is fetched again.
+const DefaultNegativeCacheTTL = 6 * time.Hour
+
+// CacheOptions selects where and how titles are cached.
+type CacheOptions struct {
+	// Backend is CacheBackendSQLite (the default) or CacheBackendJSON.
+	Backend string
+	// NegativeTTL is how long failed lookups are cached. It defaults to
+	// DefaultNegativeCacheTTL.
+	NegativeTTL time.Duration
+	// RetryFailed ignores cached failures and fetches those URLs again.
+	RetryFailed bool
+	// OverridesFile is a YAML file of pinned titles that take precedence
+	// over the cache and every fetcher, even when caching is disabled.
+	OverridesFile string
+	// File is used instead of the default cache in the XDG cache directory,
+	// e.g. for a per-project cache committed alongside the documents it
+	// covers. Unless Backend is set, a .json file uses the JSON backend and
+	// any other file SQLite.
+	File string
+	// Canonicalize controls how URLs are normalized into cache keys, which
+	// also decides which URLs are duplicates of each other.
+	Canonicalize CanonicalizeOptions
+	// ServerTTL caches titles for as long as the server's Cache-Control or
+	// Expires headers allow, but at least MinTTL, instead of DefaultCacheTTL.
+	ServerTTL bool
+	// MinTTL defaults to DefaultMinCacheTTL.
+	MinTTL time.Duration
+}
+
+func (o CacheOptions) backend() (string, error) {
+	switch o.Backend {
+	case "":
+		if strings.EqualFold(filepath.Ext(o.File), ".json") {
+			return CacheBackendJSON, nil
+		}
+		return CacheBackendSQLite, nil
+	case CacheBackendSQLite:
+		return CacheBackendSQLite, nil
+	case CacheBackendJSON:
+		return CacheBackendJSON, nil
+	}
+	return "", fmt.Errorf("invalid cache backend: %s", o.Backend)
+}
+
+// cacheSchemaVersion is the version of the cache entry layout. Version 1
+// entries held only a title or failure; version 2 added the fetch metadata.
+const cacheSchemaVersion = 2
+
+// CacheItem is a cached title, or a negative entry recording why a URL had no
+// title when Value is empty and Error is set. Pinned items hold a title chosen
+// by the user; they never expire and fetchers never replace them.
 type CacheItem struct {
-	Value     string    `json:"value"`
-	ExpiresAt time.Time `json:"expiresAt"`
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+	// FinalURL, StatusCode, Description and ContentType describe the
+	// response the title was read from, if it was fetched over HTTP.
+	FinalURL    string `json:"finalUrl,omitempty"`
+	StatusCode  int    `json:"status,omitempty"`
+	Description string `json:"description,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	// Fetcher names the fetcher that resolved the title.
+	Fetcher string `json:"fetcher,omitempty"`
+	// ETag and LastModified are the response's validators, used to
+	// revalidate the title with a conditional request once it expires.
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Pinned       bool      `json:"pinned,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
 }
 
-type Cache struct {
-	logger    logr.Logger
-	cacheFile string
-	data      map[string]CacheItem
+func (item CacheItem) Expired(now time.Time) bool {
+	return !item.Pinned && now.After(item.ExpiresAt)
 }
 
-func NewCache(logger logr.Logger) (*Cache, error) {
-	cacheFile, err := GetCachePath()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get cache path: %w", err)
+// revalidatable reports whether the item is a title the server can confirm
+// with a conditional request.
+func (item CacheItem) revalidatable() bool {
+	return item.Value != "" && (item.ETag != "" || item.LastModified != "")
+}
+
+// discardable reports whether a store should drop the item. Expired titles
+// that can be revalidated are kept for a while longer.
+func (item CacheItem) discardable(now time.Time) bool {
+	if item.isEmpty() {
+		return true
+	}
+	if !item.Expired(now) {
+		return false
 	}
+	return !item.revalidatable() || now.After(item.ExpiresAt.Add(staleCacheRetention))
+}
+
+// isEmpty reports whether the item holds neither a title nor a failure.
+func (item CacheItem) isEmpty() bool {
+	return item.Value == "" && item.Error == ""
+}
 
-	cache := &Cache{
-		logger:    logger,
-		cacheFile: cacheFile,
-		data:      make(map[string]CacheItem),
+// fetchTime returns when the item was stored. Items cached before that was
+// recorded are assumed to have been given the default TTL.
+func (item CacheItem) fetchTime() time.Time {
+	if !item.FetchedAt.IsZero() {
+		return item.FetchedAt
 	}
+	return item.ExpiresAt.Add(-DefaultCacheTTL)
+}
+
+// cacheCounters are lifetime lookup statistics kept alongside the cache.
+type cacheCounters struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// cacheChanges is a batch of writes applied by cacheStore.save.
+type cacheChanges struct {
+	upserts  map[string]CacheItem
+	deletes  []string
+	counters cacheCounters
+}
+
+// cacheStore persists cache items for a Cache.
+type cacheStore interface {
+	get(key string) (CacheItem, bool, error)
+	all() (map[string]CacheItem, error)
+	// save applies changes, adds to the counters and removes entries that
+	// expired before now, as a single transaction.
+	save(changes cacheChanges, now time.Time) error
+	counters() (cacheCounters, error)
+	// files returns the files the store keeps its data in.
+	files() []string
+	close() error
+}
+
+// Cache maps URLs to titles. Writes are buffered and persisted together by
+// CleanupAndSave. A Cache is safe for concurrent use, and its stores are safe
+// to share between processes.
+type Cache struct {
+	logger      logr.Logger
+	mu          sync.Mutex
+	store       cacheStore
+	pending     map[string]CacheItem
+	deleted     map[string]bool
+	counters    cacheCounters
+	negativeTTL time.Duration
+	serverTTL   bool
+	minTTL      time.Duration
+}
 
-	err = cache.load()
+func NewCache(logger logr.Logger, options CacheOptions) (*Cache, error) {
+	store, err := openCacheStore(logger, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load cache: %w", err)
 	}
 
+	cache := newCacheWithStore(logger, store)
+	if options.NegativeTTL > 0 {
+		cache.negativeTTL = options.NegativeTTL
+	}
+	cache.serverTTL = options.ServerTTL
+	if options.MinTTL > 0 {
+		cache.minTTL = options.MinTTL
+	}
 	return cache, nil
 }
 
+func newCacheWithStore(logger logr.Logger, store cacheStore) *Cache {
+	return &Cache{
+		logger:      logger,
+		store:       store,
+		pending:     make(map[string]CacheItem),
+		deleted:     make(map[string]bool),
+		negativeTTL: DefaultNegativeCacheTTL,
+		minTTL:      DefaultMinCacheTTL,
+	}
+}
+
+func openCacheStore(logger logr.Logger, options CacheOptions) (cacheStore, error) {
+	backend, err := options.backend()
+	if err != nil {
+		return nil, err
+	}
+	if options.File == "" {
+		if err := migrateCacheDir(logger, xdg.ConfigHome, xdg.CacheHome); err != nil {
+			logger.Error(err, "Failed to move cache out of the config directory")
+		}
+	}
+
+	path, err := GetCachePath(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache path: %w", err)
+	}
+	if options.File != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+	openJSON := func(path string) (cacheStore, error) {
+		store, err := openJSONCacheStore(logger, path)
+		if err != nil {
+			return nil, err
+		}
+		if options.File == "" {
+			return store, nil
+		}
+		store.statsPath, err = projectStatsPath(path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	if backend == CacheBackendJSON {
+		return openJSON(path)
+	}
+
+	// The default SQLite cache imports the JSON cache it replaced. Builds
+	// without SQLite use a JSON file next to the database instead.
+	jsonPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	legacyPath := ""
+	if options.File == "" {
+		jsonPath, err = GetCachePath(CacheOptions{Backend: CacheBackendJSON})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cache path: %w", err)
+		}
+		legacyPath = jsonPath
+	}
+	store, err := openSQLiteCacheStore(logger, path, legacyPath)
+	if errors.Is(err, errSQLiteUnavailable) {
+		// go-sqlite3 needs cgo; builds without it keep using the JSON cache.
+		logger.Info("SQLite cache unavailable, falling back to JSON cache", "path", jsonPath)
+		return openJSON(jsonPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// projectStatsPath returns where the lookup counters of a JSON cache file
+// chosen with CacheOptions.File are kept. They change on every run, so they
+// are kept out of the project the cache file may be committed to.
+func projectStatsPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache path: %w", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	statsPath, err := xdg.StateFile(filepath.Join("hollowbeak", "stats", hex.EncodeToString(sum[:8])+".json"))
+	if err != nil {
+		return "", fmt.Errorf("failed to get XDG state file path: %w", err)
+	}
+	return statsPath, nil
+}
+
+// Get returns the cached title for key. Every call counts towards the hit
+// rate reported by Stats.
 func (cache *Cache) Get(key string) (string, bool) {
+	result, ok := cache.GetResult(key)
+	return result.Title, ok
+}
+
+// GetResult is Get, also returning the metadata recorded with the title.
+func (cache *Cache) GetResult(key string) (TitleResult, bool) {
 	cache.logger.V(2).Info("Debug: Getting value from cache", "key", key)
-	item, ok := cache.data[key]
-	if !ok {
-		return "", false
+	item, ok := cache.lookup(key)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !ok || item.Value == "" {
+		cache.counters.Misses++
+		return TitleResult{}, false
 	}
+	cache.counters.Hits++
+	return TitleResult{
+		Title:       item.Value,
+		FinalURL:    item.FinalURL,
+		StatusCode:  item.StatusCode,
+		ContentType: item.ContentType,
+		Description: item.Description,
+		Fetcher:     item.Fetcher,
+	}, true
+}
 
-	if time.Now().After(item.ExpiresAt) {
-		cache.logger.V(2).Info("Debug: Cache item expired", "key", key)
-		delete(cache.data, key)
+// GetFailure returns the reason recorded by SetFailure for key, if it has not
+// expired yet.
+func (cache *Cache) GetFailure(key string) (string, bool) {
+	item, ok := cache.lookup(key)
+	if !ok || item.Value != "" || item.Error == "" {
 		return "", false
 	}
+	return item.Error, true
+}
 
-	if item.Value == "" {
-		cache.logger.V(2).Info("Debug: Cache item has empty value", "key", key)
-		return "", false
+// Lookup returns the unexpired entry for key, whether it holds a title or a
+// failure.
+func (cache *Cache) Lookup(key string) (CacheItem, bool) {
+	return cache.lookup(key)
+}
+
+func (cache *Cache) lookup(key string) (CacheItem, bool) {
+	item, ok := cache.lookupAny(key)
+	if !ok || item.Expired(time.Now()) {
+		if ok {
+			cache.logger.V(2).Info("Debug: Cache item expired", "key", key)
+		}
+		return CacheItem{}, false
+	}
+	return item, true
+}
+
+// lookupAny returns the entry for key, even if it has expired.
+func (cache *Cache) lookupAny(key string) (CacheItem, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.deleted[key] {
+		return CacheItem{}, false
+	}
+	item, ok := cache.pending[key]
+	if !ok {
+		var err error
+		item, ok, err = cache.store.get(key)
+		if err != nil {
+			cache.logger.Error(err, "Failed to read cache", "key", key)
+			return CacheItem{}, false
+		}
+		if !ok {
+			return CacheItem{}, false
+		}
+	}
+	return item, true
+}
+
+// Rekey moves the entry stored under legacyKey to key, unless key already has
+// one. Caches written before URLs were canonicalized hold entries under the
+// URL as it was written, and this carries them over as they are looked up.
+// It reports whether an entry was moved.
+func (cache *Cache) Rekey(key, legacyKey string) bool {
+	if key == legacyKey {
+		return false
+	}
+	if _, ok := cache.lookupAny(key); ok {
+		return false
 	}
+	item, ok := cache.lookupAny(legacyKey)
+	if !ok {
+		return false
+	}
+	cache.logger.V(2).Info("Debug: Moving cache entry to canonical key", "from", legacyKey, "to", key)
 
-	return item.Value, true
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	delete(cache.pending, legacyKey)
+	cache.deleted[legacyKey] = true
+	delete(cache.deleted, key)
+	cache.pending[key] = item
+	return true
 }
 
+// Stale returns the expired title for key if it can be revalidated with a
+// conditional request, so that the server can confirm it instead of the page
+// being fetched and parsed again.
+func (cache *Cache) Stale(key string) (CacheItem, bool) {
+	item, ok := cache.lookupAny(key)
+	if !ok || !item.Expired(time.Now()) || !item.revalidatable() {
+		return CacheItem{}, false
+	}
+	return item, true
+}
+
+// Revalidate renews the expired title for key after the server answered a
+// conditional request with 304 Not Modified, taking any new validators and
+// freshness lifetime from result. It returns the cached title with result's
+// fetch details, or false if there is no title to renew.
+func (cache *Cache) Revalidate(key string, result TitleResult) (TitleResult, bool) {
+	item, ok := cache.lookupAny(key)
+	if !ok || item.Value == "" {
+		return TitleResult{}, false
+	}
+	cache.logger.V(2).Info("Debug: Revalidated cached title", "key", key)
+
+	now := time.Now()
+	if result.ETag != "" {
+		item.ETag = result.ETag
+	}
+	if result.LastModified != "" {
+		item.LastModified = result.LastModified
+	}
+	item.FetchedAt = now
+	item.ExpiresAt = cache.expiry(now, result)
+	cache.put(key, item)
+
+	result.Title = item.Value
+	result.Description = item.Description
+	result.ContentType = item.ContentType
+	if result.FinalURL == "" {
+		result.FinalURL = item.FinalURL
+	}
+	return result, true
+}
+
+// expiry returns when a title fetched at now with result expires.
+func (cache *Cache) expiry(now time.Time, result TitleResult) time.Time {
+	if !cache.serverTTL || result.FreshUntil.IsZero() {
+		return now.Add(DefaultCacheTTL)
+	}
+	if earliest := now.Add(cache.minTTL); result.FreshUntil.Before(earliest) {
+		return earliest
+	}
+	return result.FreshUntil
+}
+
+// Set caches a fetched title for key, unless the user pinned one.
 func (cache *Cache) Set(key, value string) error {
+	return cache.SetResult(key, TitleResult{Title: value})
+}
+
+// SetResult caches a fetched title for key together with the metadata of the
+// response it came from, unless the user pinned a title.
+func (cache *Cache) SetResult(key string, result TitleResult) error {
 	cache.logger.V(2).Info("Debug: Setting value in cache", "key", key)
-	cache.data[key] = CacheItem{
-		Value:     value,
-		ExpiresAt: time.Now().Add(6 * 30 * 24 * time.Hour),
+	now := time.Now()
+	cache.put(key, CacheItem{
+		Value:        result.Title,
+		FinalURL:     result.FinalURL,
+		StatusCode:   result.StatusCode,
+		Description:  result.Description,
+		ContentType:  result.ContentType,
+		Fetcher:      result.Fetcher,
+		ETag:         result.ETag,
+		LastModified: result.LastModified,
+		FetchedAt:    now,
+		ExpiresAt:    cache.expiry(now, result),
+	})
+	return nil
+}
+
+// Pin caches title for key permanently, replacing any fetched title.
+func (cache *Cache) Pin(key, title string) error {
+	cache.logger.V(2).Info("Debug: Pinning title in cache", "key", key)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.deleted, key)
+	cache.pending[key] = CacheItem{
+		Value:     title,
+		Pinned:    true,
+		FetchedAt: time.Now(),
+	}
+	return nil
+}
+
+// Unpin removes the pinned title for key, so that it is fetched again. It
+// reports whether key was pinned.
+func (cache *Cache) Unpin(key string) (bool, error) {
+	item, ok := cache.lookup(key)
+	if !ok || !item.Pinned {
+		return false, nil
 	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	delete(cache.pending, key)
+	cache.deleted[key] = true
+	return true, nil
+}
+
+// SetFailure records that key could not be resolved. The entry expires after
+// the cache's negative TTL, so the URL is retried reasonably soon.
+func (cache *Cache) SetFailure(key, reason string) error {
+	cache.logger.V(2).Info("Debug: Caching failure", "key", key, "reason", reason)
+	now := time.Now()
+	cache.put(key, CacheItem{
+		Error:     reason,
+		FetchedAt: now,
+		ExpiresAt: now.Add(cache.negativeTTL),
+	})
 	return nil
 }
 
-func (cache *Cache) load() error {
-	cache.logger.V(1).Info("Debug: Loading cache", "path", cache.cacheFile)
-	data, err := os.ReadFile(cache.cacheFile)
+func (cache *Cache) put(key string, item CacheItem) {
+	if existing, ok := cache.lookup(key); ok && existing.Pinned {
+		cache.logger.V(2).Info("Debug: Not replacing pinned title", "key", key)
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.deleted, key)
+	cache.pending[key] = item
+}
+
+// Entries returns every entry in the cache, including expired ones that have
+// not been cleaned up yet.
+func (cache *Cache) Entries() (map[string]CacheItem, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.entries()
+}
+
+func (cache *Cache) entries() (map[string]CacheItem, error) {
+	items, err := cache.store.all()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	for key := range cache.deleted {
+		delete(items, key)
+	}
+	for key, item := range cache.pending {
+		items[key] = item
+	}
+	return items, nil
+}
+
+// Delete removes the entry for pattern, or every entry whose key matches it
+// when pattern contains "*" (any run of characters) or "?" (any single
+// character). It returns the number of entries removed.
+func (cache *Cache) Delete(pattern string) (int, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	items, err := cache.entries()
 	if err != nil {
-		if os.IsNotExist(err) {
-			cache.logger.Info("Cache file not found, starting with empty cache", "path", cache.cacheFile)
-			return nil
+		return 0, err
+	}
+
+	match := func(key string) bool { return key == pattern }
+	if strings.ContainsAny(pattern, "*?") {
+		quoted := regexp.QuoteMeta(pattern)
+		quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+		quoted = strings.ReplaceAll(quoted, `\?`, ".")
+		re := regexp.MustCompile("^" + quoted + "$")
+		match = re.MatchString
+	}
+
+	removed := 0
+	for key := range items {
+		if match(key) {
+			cache.deleted[key] = true
+			delete(cache.pending, key)
+			removed++
 		}
-		return fmt.Errorf("failed to read cache file: %w", err)
 	}
+	return removed, nil
+}
+
+// Prune removes expired entries and, if olderThan is positive, entries fetched
+// longer than olderThan ago. Pinned entries are kept. It returns the number of
+// entries removed.
+func (cache *Cache) Prune(olderThan time.Duration) (int, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
 
-	err = json.Unmarshal(data, &cache.data)
+	items, err := cache.entries()
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal cache data: %w", err)
+		return 0, err
 	}
 
-	cache.logger.V(1).Info("Debug: Cache loaded successfully", "entries", len(cache.data))
-	return nil
+	now := time.Now()
+	removed := 0
+	for key, item := range items {
+		if item.Pinned {
+			continue
+		}
+		expired := item.Expired(now) || item.isEmpty()
+		stale := olderThan > 0 && now.Sub(item.fetchTime()) > olderThan
+		if expired || stale {
+			cache.deleted[key] = true
+			delete(cache.pending, key)
+			removed++
+		}
+	}
+	return removed, nil
 }
 
-func (cache *Cache) CleanupAndSave() error {
-	cache.logger.V(1).Info("Debug: Starting cache cleanup")
+// CacheStats summarizes the contents and use of a cache.
+type CacheStats struct {
+	Entries  int
+	Negative int
+	Pinned   int
+	Expired  int
+	// SizeBytes is the size of the files backing the cache.
+	SizeBytes int64
+	Hits      int64
+	Misses    int64
+}
+
+// HitRate is the fraction of title lookups answered from the cache, or 0 if
+// there have been none.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (cache *Cache) Stats() (CacheStats, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	items, err := cache.entries()
+	if err != nil {
+		return CacheStats{}, err
+	}
+	counters, err := cache.store.counters()
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to read cache statistics: %w", err)
+	}
+
 	now := time.Now()
-	for key, item := range cache.data {
-		if now.After(item.ExpiresAt) || item.Value == "" {
-			cache.logger.V(2).Info("Debug: Removing expired or empty cache item", "key", key)
-			delete(cache.data, key)
+	stats := CacheStats{
+		Entries: len(items),
+		Hits:    counters.Hits + cache.counters.Hits,
+		Misses:  counters.Misses + cache.counters.Misses,
+	}
+	for _, item := range items {
+		if item.Expired(now) {
+			stats.Expired++
+		}
+		if item.Pinned {
+			stats.Pinned++
+		}
+		if item.Value == "" && item.Error != "" {
+			stats.Negative++
 		}
 	}
-	cache.logger.V(1).Info("Debug: Cache cleanup completed", "remainingEntries", len(cache.data))
+	for _, file := range cache.store.files() {
+		stats.SizeBytes += fileSize(file)
+	}
+	return stats, nil
+}
+
+// Export writes every entry to w in the format of the JSON cache file.
+func (cache *Cache) Export(w io.Writer) error {
+	_, err := cache.exportEntries(w, nil)
+	return err
+}
 
-	return cache.save()
+// exportEntries writes the entries keep accepts, or all of them if keep is
+// nil, as Export does. It returns the number written.
+func (cache *Cache) exportEntries(w io.Writer, keep func(CacheItem) bool) (int, error) {
+	items, err := cache.Entries()
+	if err != nil {
+		return 0, err
+	}
+	for key, item := range items {
+		if keep != nil && !keep(item) {
+			delete(items, key)
+		}
+	}
+	raw, err := encodeJSONCache(items)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.Write(raw)
+	return len(items), err
 }
 
-func (cache *Cache) save() error {
-	cache.logger.V(1).Info("Debug: Saving cache", "path", cache.cacheFile)
-	data, err := json.MarshalIndent(cache.data, "", "  ")
+// Import reads entries written by Export and adds them to the cache. Existing
+// entries are only replaced by imported ones fetched more recently, and pinned
+// entries only by other pinned ones. It returns the number of entries
+// imported.
+func (cache *Cache) Import(r io.Reader) (int, error) {
+	raw, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("failed to marshal cache data: %w", err)
+		return 0, fmt.Errorf("failed to read cache entries: %w", err)
 	}
+	imported, err := decodeJSONCache(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
 
-	err = os.WriteFile(cache.cacheFile, data, 0o644)
+	items, err := cache.entries()
 	if err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
+		return 0, err
 	}
 
+	count := 0
+	for key, item := range imported {
+		if item.isEmpty() {
+			continue
+		}
+		if existing, ok := items[key]; ok {
+			if !item.fetchTime().After(existing.fetchTime()) || (existing.Pinned && !item.Pinned) {
+				continue
+			}
+		}
+		delete(cache.deleted, key)
+		cache.pending[key] = item
+		count++
+	}
+	return count, nil
+}
+
+// CleanupAndSave persists the changes made since the last save and drops
+// expired entries.
+func (cache *Cache) CleanupAndSave() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.logger.V(1).Info("Debug: Saving cache", "pendingEntries", len(cache.pending), "deletedEntries", len(cache.deleted))
+	changes := cacheChanges{
+		upserts:  cache.pending,
+		counters: cache.counters,
+	}
+	for key := range cache.deleted {
+		changes.deletes = append(changes.deletes, key)
+	}
+	if err := cache.store.save(changes, time.Now()); err != nil {
+		return err
+	}
+	cache.pending = make(map[string]CacheItem)
+	cache.deleted = make(map[string]bool)
+	cache.counters = cacheCounters{}
 	cache.logger.V(1).Info("Debug: Cache saved successfully")
 	return nil
 }
 
-func GetCachePath() (string, error) {
-	configFilePath, err := xdg.ConfigFile(cacheFileName)
+// Close releases the underlying store. Unsaved values are discarded.
+func (cache *Cache) Close() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.store.close()
+}
+
+// GetCachePath returns the cache file selected by options: options.File if
+// set, otherwise the default file for the backend in the XDG cache directory.
+func GetCachePath(options CacheOptions) (string, error) {
+	if options.File != "" {
+		return filepath.Abs(options.File)
+	}
+
+	backend, err := options.backend()
+	if err != nil {
+		return "", err
+	}
+	name := cacheFileName
+	if backend == CacheBackendJSON {
+		name = legacyCacheFileName
+	}
+
+	cacheFilePath, err := xdg.CacheFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get XDG cache file path: %w", err)
+	}
+	return filepath.Abs(cacheFilePath)
+}
+
+// cacheFileGroups are the files making up each default cache, listed with the
+// file that identifies the cache first.
+var cacheFileGroups = [][]string{
+	{cacheFileName, cacheFileName + "-wal", cacheFileName + "-shm"},
+	{legacyCacheFileName, strings.TrimSuffix(legacyCacheFileName, ".json") + ".stats.json"},
+}
+
+// migrateCacheDir moves default caches from fromDir, where earlier versions
+// kept them in the XDG config directory, to toDir. A cache that already exists
+// in toDir is left alone in both places.
+func migrateCacheDir(logger logr.Logger, fromDir, toDir string) error {
+	for _, group := range cacheFileGroups {
+		from := filepath.Join(fromDir, group[0])
+		to := filepath.Join(toDir, group[0])
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			logger.Info("Ignoring cache in config directory, one already exists in cache directory", "path", from, "cachePath", to)
+			continue
+		}
+
+		for _, name := range group {
+			if err := moveFile(filepath.Join(fromDir, name), filepath.Join(toDir, name)); err != nil {
+				if os.IsNotExist(err) {
+					// Not every cache has every file, and another
+					// process may be moving them concurrently.
+					continue
+				}
+				return fmt.Errorf("failed to move %s: %w", name, err)
+			}
+		}
+		logger.Info("Moved cache to XDG cache directory", "from", from, "to", to)
+	}
+	return nil
+}
+
+// moveFile renames from to to, copying it if they are on different file
+// systems.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil || os.IsNotExist(err) {
+		return err
+	}
+
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(to, data, 0o644); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to get XDG config file path: %w", err)
+		return 0
 	}
-	return filepath.Abs(configFilePath)
+	return info.Size()
 }
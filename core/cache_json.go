@@ -0,0 +1,205 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// jsonCacheStore keeps the whole cache in memory and rewrites a single JSON
+// file on save. Saves hold a lock file and merge with what is on disk, so
+// hollowbeak processes running at the same time keep each other's entries.
+// Lookup counters are kept in a separate .stats.json file, next to it unless
+// statsPath says otherwise, leaving the cache file itself just the entries.
+type jsonCacheStore struct {
+	logger    logr.Logger
+	path      string
+	statsPath string
+	data      map[string]CacheItem
+}
+
+func openJSONCacheStore(logger logr.Logger, path string) (*jsonCacheStore, error) {
+	store := &jsonCacheStore{
+		logger:    logger,
+		path:      path,
+		statsPath: strings.TrimSuffix(path, ".json") + ".stats.json",
+		data:      make(map[string]CacheItem),
+	}
+
+	logger.V(1).Info("Debug: Loading cache", "path", path)
+	data, err := readJSONCacheFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		logger.Info("Cache file not found, starting with empty cache", "path", path)
+		return store, nil
+	}
+	store.data = data
+
+	logger.V(1).Info("Debug: Cache loaded successfully", "entries", len(store.data))
+	return store, nil
+}
+
+// readJSONCacheFile returns the items in a JSON cache file, or nil if the file
+// does not exist.
+func readJSONCacheFile(path string) (map[string]CacheItem, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	return decodeJSONCache(raw)
+}
+
+// jsonCacheDocument is the layout of JSON cache files and exports.
+type jsonCacheDocument struct {
+	Version int                  `json:"version"`
+	Entries map[string]CacheItem `json:"entries"`
+}
+
+// decodeJSONCache reads a jsonCacheDocument, or the plain URL-to-item map
+// written before the layout was versioned.
+func decodeJSONCache(raw []byte) (map[string]CacheItem, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache data: %w", err)
+	}
+	_, hasVersion := fields["version"]
+	_, hasEntries := fields["entries"]
+	if !hasVersion || !hasEntries {
+		data := make(map[string]CacheItem)
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cache data: %w", err)
+		}
+		return data, nil
+	}
+
+	var doc jsonCacheDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache data: %w", err)
+	}
+	if doc.Version > cacheSchemaVersion {
+		return nil, fmt.Errorf("unsupported cache version %d, newer than %d", doc.Version, cacheSchemaVersion)
+	}
+	if doc.Entries == nil {
+		doc.Entries = make(map[string]CacheItem)
+	}
+	return doc.Entries, nil
+}
+
+func encodeJSONCache(data map[string]CacheItem) ([]byte, error) {
+	raw, err := json.MarshalIndent(jsonCacheDocument{Version: cacheSchemaVersion, Entries: data}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache data: %w", err)
+	}
+	return append(raw, '\n'), nil
+}
+
+func (s *jsonCacheStore) get(key string) (CacheItem, bool, error) {
+	item, ok := s.data[key]
+	return item, ok, nil
+}
+
+func (s *jsonCacheStore) all() (map[string]CacheItem, error) {
+	items := make(map[string]CacheItem, len(s.data))
+	for key, item := range s.data {
+		items[key] = item
+	}
+	return items, nil
+}
+
+func (s *jsonCacheStore) save(changes cacheChanges, now time.Time) error {
+	lock, err := acquireFileLock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock cache file: %w", err)
+	}
+	defer func() {
+		if err := lock.release(); err != nil {
+			s.logger.Error(err, "Failed to unlock cache file", "path", s.path)
+		}
+	}()
+
+	// Start from the file as it is now rather than as it was loaded, since
+	// another process may have saved in the meantime.
+	data, err := readJSONCacheFile(s.path)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = make(map[string]CacheItem)
+	}
+	s.logger.V(2).Info("Debug: Merging cache with file on disk", "onDisk", len(data), "updates", len(changes.upserts), "deletes", len(changes.deletes))
+	for key, item := range changes.upserts {
+		if existing, ok := data[key]; ok && existing.Pinned && !item.Pinned {
+			continue
+		}
+		data[key] = item
+	}
+	for _, key := range changes.deletes {
+		delete(data, key)
+	}
+	for key, item := range data {
+		if item.discardable(now) {
+			s.logger.V(2).Info("Debug: Removing expired or empty cache item", "key", key)
+			delete(data, key)
+		}
+	}
+
+	s.logger.V(1).Info("Debug: Writing cache file", "path", s.path, "entries", len(data))
+	raw, err := encodeJSONCache(data)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	s.data = data
+
+	if changes.counters == (cacheCounters{}) {
+		return nil
+	}
+	counters, err := s.counters()
+	if err != nil {
+		return err
+	}
+	counters.Hits += changes.counters.Hits
+	counters.Misses += changes.counters.Misses
+	raw, err = json.Marshal(counters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache statistics: %w", err)
+	}
+	if err := writeFileAtomic(s.statsPath, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache statistics: %w", err)
+	}
+	return nil
+}
+
+func (s *jsonCacheStore) counters() (cacheCounters, error) {
+	var counters cacheCounters
+	raw, err := os.ReadFile(s.statsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return counters, nil
+		}
+		return counters, fmt.Errorf("failed to read cache statistics: %w", err)
+	}
+	if err := json.Unmarshal(raw, &counters); err != nil {
+		return counters, fmt.Errorf("failed to unmarshal cache statistics: %w", err)
+	}
+	return counters, nil
+}
+
+func (s *jsonCacheStore) files() []string {
+	return []string{s.path, s.statsPath}
+}
+
+func (s *jsonCacheStore) close() error {
+	return nil
+}
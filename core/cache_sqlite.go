@@ -0,0 +1,324 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteCacheMigrations are applied in order to bring a cache database up to
+// date; the number applied so far is kept in PRAGMA user_version.
+var sqliteCacheMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS cache_items (
+		key        TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS cache_items_expires_at ON cache_items (expires_at);`,
+	`ALTER TABLE cache_items ADD COLUMN error TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE cache_items ADD COLUMN fetched_at INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE IF NOT EXISTS cache_counters (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);`,
+	`ALTER TABLE cache_items ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE cache_items ADD COLUMN final_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE cache_items ADD COLUMN status INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE cache_items ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE cache_items ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE cache_items ADD COLUMN fetcher TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE cache_items ADD COLUMN etag TEXT NOT NULL DEFAULT '';
+	ALTER TABLE cache_items ADD COLUMN last_modified TEXT NOT NULL DEFAULT '';`,
+}
+
+// errSQLiteUnavailable is returned by openSQLiteCacheStore in builds without
+// the SQLite driver.
+var errSQLiteUnavailable = errors.New("SQLite support requires a build with cgo")
+
+// sqliteCacheStore keeps cache items in a SQLite database, so lookups do not
+// load the whole cache and saves only touch the rows that changed.
+type sqliteCacheStore struct {
+	logger logr.Logger
+	path   string
+	db     *sql.DB
+}
+
+// openSQLiteCacheStore opens or creates the cache database at path. Items in
+// the JSON cache at legacyPath, if given, are imported once, after which the
+// JSON file is renamed out of the way.
+func openSQLiteCacheStore(logger logr.Logger, path, legacyPath string) (*sqliteCacheStore, error) {
+	logger.V(1).Info("Debug: Opening SQLite cache", "path", path)
+	if !sqliteAvailable {
+		return nil, errSQLiteUnavailable
+	}
+	// WAL lets readers proceed while another hollowbeak process writes.
+	// Immediate transactions take the write lock up front, so concurrent
+	// writers wait out the busy timeout instead of failing to upgrade a lock.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database: %w", err)
+	}
+
+	store := &sqliteCacheStore{logger: logger, path: path, db: db}
+	if err := store.migrateSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate cache schema: %w", err)
+	}
+	if err := store.migrateJSON(legacyPath); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *sqliteCacheStore) migrateSchema() error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		var version int
+		if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+			return err
+		}
+		for ; version < len(sqliteCacheMigrations); version++ {
+			s.logger.V(1).Info("Debug: Applying cache schema migration", "version", version+1)
+			if _, err := tx.Exec(sqliteCacheMigrations[version]); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version))
+		return err
+	})
+}
+
+func (s *sqliteCacheStore) migrateJSON(legacyPath string) error {
+	if legacyPath == "" {
+		return nil
+	}
+	items, err := readJSONCacheFile(legacyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read legacy cache: %w", err)
+	}
+	if items == nil {
+		return nil
+	}
+
+	// Existing rows win, in case an earlier migration committed but could not
+	// rename the JSON file.
+	err = s.inTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT OR IGNORE INTO cache_items (key, ` + sqliteCacheColumns + `) VALUES ` + sqliteCacheValues)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for key, item := range items {
+			if item.isEmpty() {
+				continue
+			}
+			if _, err := stmt.Exec(cacheItemArgs(key, item)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate legacy cache: %w", err)
+	}
+
+	if err := os.Rename(legacyPath, legacyPath+".migrated"); err != nil {
+		if os.IsNotExist(err) {
+			// Another process migrated it concurrently.
+			return nil
+		}
+		return fmt.Errorf("failed to rename legacy cache: %w", err)
+	}
+	s.logger.Info("Migrated JSON cache to SQLite", "from", legacyPath, "entries", len(items))
+	return nil
+}
+
+const (
+	sqliteCacheColumns = `value, error, pinned, fetched_at, expires_at, final_url, status, description, content_type, fetcher, etag, last_modified`
+	sqliteCacheValues  = `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+)
+
+// cacheItemArgs returns key and the fields of item in the order of
+// sqliteCacheColumns.
+func cacheItemArgs(key string, item CacheItem) []any {
+	return []any{
+		key, item.Value, item.Error, item.Pinned, unixOrZero(item.FetchedAt), item.ExpiresAt.Unix(),
+		item.FinalURL, item.StatusCode, item.Description, item.ContentType, item.Fetcher,
+		item.ETag, item.LastModified,
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCacheItem(row rowScanner, dest ...any) (CacheItem, error) {
+	var item CacheItem
+	var fetchedAt, expiresAt int64
+	dest = append(dest, &item.Value, &item.Error, &item.Pinned, &fetchedAt, &expiresAt,
+		&item.FinalURL, &item.StatusCode, &item.Description, &item.ContentType, &item.Fetcher,
+		&item.ETag, &item.LastModified)
+	if err := row.Scan(dest...); err != nil {
+		return CacheItem{}, err
+	}
+	if fetchedAt != 0 {
+		item.FetchedAt = time.Unix(fetchedAt, 0)
+	}
+	item.ExpiresAt = time.Unix(expiresAt, 0)
+	return item, nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func (s *sqliteCacheStore) get(key string) (CacheItem, bool, error) {
+	item, err := scanCacheItem(s.db.QueryRow(`SELECT `+sqliteCacheColumns+` FROM cache_items WHERE key = ?`, key))
+	if err == sql.ErrNoRows {
+		return CacheItem{}, false, nil
+	}
+	if err != nil {
+		return CacheItem{}, false, fmt.Errorf("failed to query cache: %w", err)
+	}
+	return item, true, nil
+}
+
+func (s *sqliteCacheStore) all() (map[string]CacheItem, error) {
+	rows, err := s.db.Query(`SELECT key, ` + sqliteCacheColumns + ` FROM cache_items`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache: %w", err)
+	}
+	defer rows.Close()
+
+	items := make(map[string]CacheItem)
+	for rows.Next() {
+		var key string
+		item, err := scanCacheItem(rows, &key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan cache item: %w", err)
+		}
+		items[key] = item
+	}
+	return items, rows.Err()
+}
+
+func (s *sqliteCacheStore) save(changes cacheChanges, now time.Time) error {
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`
+			INSERT INTO cache_items (key, ` + sqliteCacheColumns + `) VALUES ` + sqliteCacheValues + `
+			ON CONFLICT (key) DO UPDATE SET
+				value = excluded.value,
+				error = excluded.error,
+				pinned = excluded.pinned,
+				fetched_at = excluded.fetched_at,
+				expires_at = excluded.expires_at,
+				final_url = excluded.final_url,
+				status = excluded.status,
+				description = excluded.description,
+				content_type = excluded.content_type,
+				fetcher = excluded.fetcher,
+				etag = excluded.etag,
+				last_modified = excluded.last_modified
+			WHERE cache_items.pinned = 0 OR excluded.pinned = 1`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for key, item := range changes.upserts {
+			if _, err := stmt.Exec(cacheItemArgs(key, item)...); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range changes.deletes {
+			if _, err := tx.Exec(`DELETE FROM cache_items WHERE key = ?`, key); err != nil {
+				return err
+			}
+		}
+
+		for name, delta := range map[string]int64{"hits": changes.counters.Hits, "misses": changes.counters.Misses} {
+			if delta == 0 {
+				continue
+			}
+			_, err := tx.Exec(`
+				INSERT INTO cache_counters (name, value) VALUES (?, ?)
+				ON CONFLICT (name) DO UPDATE SET value = value + excluded.value`, name, delta)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Mirrors CacheItem.discardable.
+		result, err := tx.Exec(`
+			DELETE FROM cache_items WHERE pinned = 0 AND (
+				(value = '' AND error = '') OR
+				(expires_at < ? AND (value = '' OR (etag = '' AND last_modified = ''))) OR
+				expires_at < ?
+			)`, now.Unix(), now.Add(-staleCacheRetention).Unix())
+		if err != nil {
+			return err
+		}
+		if removed, err := result.RowsAffected(); err == nil && removed > 0 {
+			s.logger.V(1).Info("Debug: Removed expired cache items", "count", removed)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteCacheStore) counters() (cacheCounters, error) {
+	var counters cacheCounters
+	rows, err := s.db.Query(`SELECT name, value FROM cache_counters`)
+	if err != nil {
+		return counters, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return counters, err
+		}
+		switch name {
+		case "hits":
+			counters.Hits = value
+		case "misses":
+			counters.Misses = value
+		}
+	}
+	return counters, rows.Err()
+}
+
+func (s *sqliteCacheStore) files() []string {
+	return []string{s.path, s.path + "-wal"}
+}
+
+func (s *sqliteCacheStore) inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteCacheStore) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,429 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/go-logr/logr/testr"
+)
+
+func TestSQLiteCacheStoreMigratesJSONCache(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "data.json")
+	dbPath := filepath.Join(dir, "cache.db")
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	legacy := `{
+  "https://a.example": {"value": "A", "expiresAt": "` + expiresAt.Format(time.RFC3339) + `"},
+  "https://b.example": {"value": "", "expiresAt": "` + expiresAt.Format(time.RFC3339) + `"}
+}`
+	if err := os.WriteFile(legacyPath, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openSQLiteCacheStore(testr.New(t), dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("openSQLiteCacheStore failed: %v", err)
+	}
+	defer store.close()
+
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Errorf("legacy cache was not renamed: %v", err)
+	}
+	if _, err := os.Stat(legacyPath + ".migrated"); err != nil {
+		t.Errorf("renamed legacy cache missing: %v", err)
+	}
+
+	item, ok, err := store.get("https://a.example")
+	if err != nil || !ok || item.Value != "A" || !item.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("get migrated item = %+v, %v, %v", item, ok, err)
+	}
+	if _, ok, _ := store.get("https://b.example"); ok {
+		t.Error("empty legacy item was migrated")
+	}
+}
+
+func TestSQLiteCacheStoreSave(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openSQLiteCacheStore(testr.New(t), filepath.Join(dir, "cache.db"), filepath.Join(dir, "data.json"))
+	if err != nil {
+		t.Fatalf("openSQLiteCacheStore failed: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now()
+	err = store.save(cacheChanges{upserts: map[string]CacheItem{
+		"https://a.example":   {Value: "A", ExpiresAt: now.Add(time.Hour)},
+		"https://old.example": {Value: "Old", ExpiresAt: now.Add(-time.Hour)},
+	}}, now)
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := store.save(cacheChanges{upserts: map[string]CacheItem{"https://a.example": {Value: "A2", ExpiresAt: now.Add(time.Hour)}}}, now); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	if item, ok, _ := store.get("https://a.example"); !ok || item.Value != "A2" {
+		t.Errorf("upserted item = %+v, %v", item, ok)
+	}
+	if _, ok, _ := store.get("https://old.example"); ok {
+		t.Error("expired item was kept")
+	}
+}
+
+func TestJSONCacheStoreMergesConcurrentSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	logger := testr.New(t)
+
+	first, err := openJSONCacheStore(logger, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := openJSONCacheStore(logger, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	if err := first.save(cacheChanges{upserts: map[string]CacheItem{"https://a.example": {Value: "A", ExpiresAt: expiresAt}}}, now); err != nil {
+		t.Fatalf("first save failed: %v", err)
+	}
+	if err := second.save(cacheChanges{upserts: map[string]CacheItem{"https://b.example": {Value: "B", ExpiresAt: expiresAt}}}, now); err != nil {
+		t.Fatalf("second save failed: %v", err)
+	}
+
+	data, err := readJSONCacheFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["https://a.example"].Value != "A" || data["https://b.example"].Value != "B" {
+		t.Errorf("cache file = %+v, want both entries", data)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestCacheConcurrentUse(t *testing.T) {
+	store, err := openJSONCacheStore(testr.New(t), filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCacheWithStore(testr.New(t), store)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("https://%d.example", i)
+			cache.Set(key, "title")
+			cache.Get(key)
+			if i%4 == 0 {
+				if err := cache.CleanupAndSave(); err != nil {
+					t.Errorf("CleanupAndSave failed: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		if _, ok := cache.Get(fmt.Sprintf("https://%d.example", i)); !ok {
+			t.Errorf("entry %d missing", i)
+		}
+	}
+}
+
+func TestSQLiteCacheStoreUpgradesSchema(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.db")
+
+	// A database created before negative entries were stored.
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(sqliteCacheMigrations[0]); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := openSQLiteCacheStore(testr.New(t), path, filepath.Join(dir, "data.json"))
+	if err != nil {
+		t.Fatalf("openSQLiteCacheStore failed: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now()
+	item := CacheItem{Error: "HTTP 404", ExpiresAt: now.Add(time.Hour)}
+	if err := store.save(cacheChanges{upserts: map[string]CacheItem{"https://gone.example": item}}, now); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if got, ok, _ := store.get("https://gone.example"); !ok || got.Error != "HTTP 404" || got.Value != "" {
+		t.Errorf("negative item = %+v, %v", got, ok)
+	}
+}
+
+func TestCacheManagement(t *testing.T) {
+	logger := testr.New(t)
+	store, err := openJSONCacheStore(logger, filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCacheWithStore(logger, store)
+
+	cache.Set("https://a.example/1", "A1")
+	cache.Set("https://a.example/2", "A2")
+	cache.Set("https://b.example/", "B")
+	cache.SetFailure("https://gone.example/", "HTTP 404")
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := cache.Delete("https://a.example/*"); err != nil || removed != 2 {
+		t.Errorf("Delete pattern removed %d, %v; want 2", removed, err)
+	}
+	if _, ok := cache.Get("https://a.example/1"); ok {
+		t.Error("deleted entry is still returned")
+	}
+	cache.Get("https://b.example/")
+
+	stats, err := cache.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Negative != 1 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// An older export must not replace a newer entry.
+	export := `{
+  "https://b.example/": {"value": "Old B", "fetchedAt": "2020-01-01T00:00:00Z", "expiresAt": "2999-01-01T00:00:00Z"},
+  "https://c.example/": {"value": "C", "fetchedAt": "2020-01-01T00:00:00Z", "expiresAt": "2999-01-01T00:00:00Z"}
+}`
+	if imported, err := cache.Import(strings.NewReader(export)); err != nil || imported != 1 {
+		t.Errorf("Import = %d, %v; want 1", imported, err)
+	}
+	if title, _ := cache.Get("https://b.example/"); title != "B" {
+		t.Errorf("title after import = %q, want %q", title, "B")
+	}
+
+	if removed, err := cache.Prune(24 * time.Hour); err != nil || removed != 1 {
+		t.Errorf("Prune removed %d, %v; want the imported entry only", removed, err)
+	}
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openJSONCacheStore(logger, store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ := reopened.all()
+	if len(items) != 2 {
+		t.Errorf("saved entries = %v, want b and gone", items)
+	}
+	counters, _ := reopened.counters()
+	if counters.Hits != 2 || counters.Misses != 1 {
+		t.Errorf("saved counters = %+v", counters)
+	}
+}
+
+func TestCachePinnedTitles(t *testing.T) {
+	logger := testr.New(t)
+	store, err := openJSONCacheStore(logger, filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCacheWithStore(logger, store)
+
+	cache.Set("https://a.example/", "Fetched")
+	cache.Pin("https://a.example/", "Mine")
+	cache.Set("https://a.example/", "Fetched again")
+	cache.SetFailure("https://a.example/", "HTTP 500")
+	if title, _ := cache.Get("https://a.example/"); title != "Mine" {
+		t.Errorf("title = %q, want the pinned title", title)
+	}
+
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+	if removed, _ := cache.Prune(time.Nanosecond); removed != 0 {
+		t.Errorf("Prune removed %d pinned entries", removed)
+	}
+
+	// A concurrent process saving a fetched title must not replace the pin.
+	other, err := openJSONCacheStore(logger, store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := other.save(cacheChanges{upserts: map[string]CacheItem{"https://a.example/": {Value: "Other", ExpiresAt: now.Add(time.Hour)}}}, now); err != nil {
+		t.Fatal(err)
+	}
+	if item, _, _ := other.get("https://a.example/"); item.Value != "Mine" || !item.Pinned {
+		t.Errorf("after concurrent save, item = %+v", item)
+	}
+
+	if unpinned, _ := cache.Unpin("https://a.example/"); !unpinned {
+		t.Error("Unpin reported the title as not pinned")
+	}
+	if _, ok := cache.Get("https://a.example/"); ok {
+		t.Error("unpinned title is still cached")
+	}
+}
+
+func TestMigrateCacheDir(t *testing.T) {
+	configDir := t.TempDir()
+	cacheDir := t.TempDir()
+	for _, name := range []string{cacheFileName, cacheFileName + "-wal", legacyCacheFileName} {
+		path := filepath.Join(configDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A JSON cache already in the cache directory wins over the old one.
+	existing := filepath.Join(cacheDir, legacyCacheFileName)
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateCacheDir(testr.New(t), configDir, cacheDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{cacheFileName, cacheFileName + "-wal"} {
+		if raw, err := os.ReadFile(filepath.Join(cacheDir, name)); err != nil || string(raw) != name {
+			t.Errorf("%s in cache directory = %q, %v", name, raw, err)
+		}
+		if _, err := os.Stat(filepath.Join(configDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left in config directory: %v", name, err)
+		}
+	}
+	if raw, _ := os.ReadFile(existing); string(raw) != "new" {
+		t.Errorf("existing cache was overwritten with %q", raw)
+	}
+}
+
+// useTempXDGState points the XDG state directory, where per-project caches
+// keep their counters, at a temporary directory for the rest of the test.
+func useTempXDGState(t *testing.T) {
+	t.Helper()
+	// Cleanups run last in, first out, so this reload happens after
+	// Setenv has restored the environment.
+	t.Cleanup(xdg.Reload)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+}
+
+func TestCacheOptionsFile(t *testing.T) {
+	useTempXDGState(t)
+
+	path := filepath.Join(t.TempDir(), "docs", "titles.json")
+	options := CacheOptions{File: path}
+	if backend, _ := options.backend(); backend != CacheBackendJSON {
+		t.Errorf("backend for %s = %s", path, backend)
+	}
+	if backend, _ := (CacheOptions{File: "titles.db"}).backend(); backend != CacheBackendSQLite {
+		t.Errorf("backend for titles.db = %s", backend)
+	}
+
+	cache, err := NewCache(testr.New(t), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("https://a.example/", "A")
+	cache.Get("https://b.example/")
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readJSONCacheFile(path)
+	if err != nil || data["https://a.example/"].Value != "A" {
+		t.Errorf("cache file = %+v, %v", data, err)
+	}
+	if files, _ := os.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Errorf("cache directory holds %d files, want just the cache file", len(files))
+	}
+	if stats, err := cache.Stats(); err != nil || stats.Misses != 1 {
+		t.Errorf("stats = %+v, %v, want the miss counted", stats, err)
+	}
+	cache.Close()
+}
+
+func TestNewCacheReportsBrokenDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "titles.db")
+	if err := os.WriteFile(path, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCache(testr.New(t), CacheOptions{File: path}); err == nil {
+		t.Error("NewCache succeeded with a corrupt database")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "titles.json")); !os.IsNotExist(err) {
+		t.Errorf("fell back to a JSON cache: %v", err)
+	}
+}
+
+func TestCacheStoresMetadata(t *testing.T) {
+	dir := t.TempDir()
+	logger := testr.New(t)
+	jsonStore, err := openJSONCacheStore(logger, filepath.Join(dir, "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteStore, err := openSQLiteCacheStore(logger, filepath.Join(dir, "cache.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteStore.close()
+
+	want := TitleResult{
+		Title:       "A",
+		FinalURL:    "https://a.example/home",
+		StatusCode:  200,
+		ContentType: "text/html",
+		Description: "About A",
+		Fetcher:     "http",
+	}
+	for name, store := range map[string]cacheStore{"json": jsonStore, "sqlite": sqliteStore} {
+		cache := newCacheWithStore(logger, store)
+		cache.SetResult("https://a.example/", want)
+		if err := cache.CleanupAndSave(); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := newCacheWithStore(logger, store).GetResult("https://a.example/"); !ok || got != want {
+			t.Errorf("%s: GetResult = %+v, %v; want %+v", name, got, ok, want)
+		}
+	}
+
+	raw, err := os.ReadFile(jsonStore.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(raw), "{\n  \"version\": 2,") {
+		t.Errorf("JSON cache file is not versioned:\n%s", raw)
+	}
+	if _, err := decodeJSONCache([]byte(`{"version": 3, "entries": {}}`)); err == nil {
+		t.Error("newer cache version was accepted")
+	}
+}
@@ -0,0 +1,480 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-logr/logr"
+)
+
+// DefaultCacheSyncFile is where the shared cache is kept in a sync repository.
+const DefaultCacheSyncFile = "hollowbeak-cache.json"
+
+const (
+	defaultCacheSyncBranch = "main"
+	cacheSyncRemote        = "origin"
+	cacheSyncAttempts      = 3
+)
+
+// CacheSyncOptions selects the git repository a cache is shared through.
+type CacheSyncOptions struct {
+	// Repository is the URL of a remote repository, or the path of a local
+	// one. A local repository with a working tree is committed to in place,
+	// and pulled from and pushed to its remote if it has one; anything else
+	// is cloned and pushed to.
+	Repository string
+	// Branch defaults to the remote's default branch, or "main" if the
+	// remote is empty. It is ignored for local working trees, which are
+	// committed to on their current branch.
+	Branch string
+	// File is the path of the shared cache within the repository. It
+	// defaults to DefaultCacheSyncFile.
+	File string
+	// CheckoutDir is where remote repositories are cloned. It defaults to a
+	// directory in the XDG cache directory.
+	CheckoutDir string
+}
+
+// CacheSyncResult reports what a sync changed.
+type CacheSyncResult struct {
+	// Imported is the number of entries taken from the shared cache.
+	Imported int
+	// Exported is the number of entries written to the shared cache.
+	Exported  int
+	Committed bool
+	Pushed    bool
+}
+
+// SyncCache merges the shared cache in a git repository into cache, keeping
+// the most recently fetched entry for each URL, then commits cache's titles
+// back to the repository and pushes them. Failed lookups are not shared, and
+// neither are pinned titles, which are one user's overrides.
+// The caller saves cache.
+func SyncCache(ctx context.Context, logger logr.Logger, cache *Cache, options CacheSyncOptions) (CacheSyncResult, error) {
+	if options.Repository == "" {
+		return CacheSyncResult{}, fmt.Errorf("no cache sync repository configured")
+	}
+	if options.File == "" {
+		options.File = DefaultCacheSyncFile
+	}
+
+	var target cacheSyncTarget
+	if repo, ok := openLocalWorktree(options.Repository); ok {
+		remote, err := localSyncRemote(repo)
+		if err != nil {
+			return CacheSyncResult{}, err
+		}
+		logger.V(1).Info("Debug: Syncing cache with local repository", "path", options.Repository, "remote", remote)
+		target = cacheSyncTarget{repo: repo, remote: remote, local: true}
+		if remote == "" {
+			return syncCacheOnce(ctx, logger, cache, target, options)
+		}
+	} else {
+		checkoutDir, err := cacheSyncCheckoutDir(options)
+		if err != nil {
+			return CacheSyncResult{}, err
+		}
+		logger.V(1).Info("Debug: Syncing cache with remote repository", "url", options.Repository, "checkout", checkoutDir)
+		repo, err := openSyncCheckout(checkoutDir, options.Repository)
+		if err != nil {
+			return CacheSyncResult{}, err
+		}
+		target = cacheSyncTarget{repo: repo, remote: cacheSyncRemote}
+	}
+
+	// A push is rejected if someone else pushed since the fetch; fetching
+	// and merging again resolves that.
+	var result CacheSyncResult
+	var err error
+	for attempt := 1; attempt <= cacheSyncAttempts; attempt++ {
+		result, err = syncCacheOnce(ctx, logger, cache, target, options)
+		if err == nil || ctx.Err() != nil || errors.Is(err, errCacheSyncConflict) {
+			break
+		}
+		logger.V(1).Info("Debug: Cache sync failed", "attempt", attempt, "error", err.Error())
+	}
+	return result, err
+}
+
+// errCacheSyncConflict marks failures that syncing again cannot resolve.
+var errCacheSyncConflict = errors.New("cache sync conflict")
+
+// cacheSyncTarget is the repository a cache is synced through.
+type cacheSyncTarget struct {
+	repo *git.Repository
+	// remote is pulled from and pushed to. A local repository without one is
+	// only committed to.
+	remote string
+	// local is set for the user's own working tree, which is fast-forwarded
+	// instead of reset, and where nothing but the shared cache is committed.
+	local bool
+}
+
+// localSyncRemote returns the remote the current branch of a local repository
+// tracks, or origin, or "" if the repository has neither.
+func localSyncRemote(repo *git.Repository) (string, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to read repository config: %w", err)
+	}
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		if branch, ok := cfg.Branches[head.Name().Short()]; ok && branch.Remote != "" && branch.Remote != "." {
+			return branch.Remote, nil
+		}
+	}
+	if _, ok := cfg.Remotes[cacheSyncRemote]; ok {
+		return cacheSyncRemote, nil
+	}
+	return "", nil
+}
+
+// openLocalWorktree opens path if it is a local repository with a working
+// tree.
+func openLocalWorktree(path string) (*git.Repository, bool) {
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil, false
+	}
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := repo.Worktree(); err != nil {
+		return nil, false
+	}
+	return repo, true
+}
+
+func cacheSyncCheckoutDir(options CacheSyncOptions) (string, error) {
+	if options.CheckoutDir != "" {
+		return options.CheckoutDir, nil
+	}
+	sum := sha256.Sum256([]byte(options.Repository))
+	dir, err := xdg.CacheFile(filepath.Join("hollowbeak", "sync", hex.EncodeToString(sum[:8])))
+	if err != nil {
+		return "", fmt.Errorf("failed to get XDG cache file path: %w", err)
+	}
+	return dir, nil
+}
+
+// openSyncCheckout opens the clone of url in dir, creating it if needed. The
+// clone is only ever reset to the remote, so it is created with init and
+// fetch rather than clone, which also works for an empty remote.
+func openSyncCheckout(dir, url string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repo, err = git.PlainInit(dir, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cache sync checkout: %w", err)
+		}
+		_, err = repo.CreateRemote(&config.RemoteConfig{Name: cacheSyncRemote, URLs: []string{url}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add cache sync remote: %w", err)
+		}
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache sync checkout: %w", err)
+	}
+	return repo, nil
+}
+
+func syncCacheOnce(ctx context.Context, logger logr.Logger, cache *Cache, target cacheSyncTarget, options CacheSyncOptions) (CacheSyncResult, error) {
+	var result CacheSyncResult
+	repo := target.repo
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return result, fmt.Errorf("failed to open worktree: %w", err)
+	}
+	file := filepath.ToSlash(options.File)
+	if target.local {
+		if err := checkNothingElseStaged(worktree, file); err != nil {
+			return result, err
+		}
+	}
+
+	var branch plumbing.ReferenceName
+	switch {
+	case target.local && target.remote != "":
+		branch, err = fastForwardToRemote(ctx, logger, repo, worktree, target.remote)
+	case !target.local:
+		branch, err = resetToRemote(ctx, logger, repo, worktree, options.Branch)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	path := filepath.Join(worktree.Filesystem.Root(), options.File)
+	if file, err := os.Open(path); err == nil {
+		result.Imported, err = cache.Import(file)
+		file.Close()
+		if err != nil {
+			return result, fmt.Errorf("failed to import shared cache: %w", err)
+		}
+		logger.V(1).Info("Debug: Imported shared cache", "entries", result.Imported)
+	} else if !os.IsNotExist(err) {
+		return result, fmt.Errorf("failed to open shared cache: %w", err)
+	}
+
+	var buf bytes.Buffer
+	now := time.Now()
+	result.Exported, err = cache.exportEntries(&buf, func(item CacheItem) bool {
+		return item.Value != "" && !item.Pinned && !item.Expired(now)
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return result, fmt.Errorf("failed to create shared cache directory: %w", err)
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0o644); err != nil {
+		return result, fmt.Errorf("failed to write shared cache: %w", err)
+	}
+
+	result.Committed, err = commitCacheFile(repo, worktree, file)
+	if err != nil || target.remote == "" {
+		return result, err
+	}
+
+	// Pushing also creates the branch if the remote does not have it yet.
+	refSpec := config.RefSpec(branch.String() + ":" + branch.String())
+	err = repo.PushContext(ctx, &git.PushOptions{RemoteName: target.remote, RefSpecs: []config.RefSpec{refSpec}})
+	switch {
+	case errors.Is(err, git.NoErrAlreadyUpToDate):
+	case err != nil:
+		if target.local && result.Committed {
+			// Take the commit back, so that the next attempt can fast-forward
+			// to what was pushed and commit on top of it.
+			if undoErr := undoCommit(repo, worktree); undoErr != nil {
+				return result, fmt.Errorf("failed to push shared cache: %w, and failed to undo the commit: %v", err, undoErr)
+			}
+			result.Committed = false
+		}
+		return result, fmt.Errorf("failed to push shared cache: %w", err)
+	default:
+		result.Pushed = true
+	}
+	return result, nil
+}
+
+// checkNothingElseStaged fails if changes other than to file are staged, as
+// they would be committed with it.
+func checkNothingElseStaged(worktree *git.Worktree, file string) error {
+	status, err := worktree.Status()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	for path, fileStatus := range status {
+		if path == file || fileStatus.Staging == git.Unmodified || fileStatus.Staging == git.Untracked {
+			continue
+		}
+		return fmt.Errorf("%w: %s is staged; commit or unstage it before syncing", errCacheSyncConflict, path)
+	}
+	return nil
+}
+
+// fastForwardToRemote fetches remote and fast-forwards the checked-out branch
+// of a local repository to its counterpart there, if it is behind. It returns
+// the branch.
+func fastForwardToRemote(ctx context.Context, logger logr.Logger, repo *git.Repository, worktree *git.Worktree, remote string) (plumbing.ReferenceName, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	branch := head.Name()
+	if !branch.IsBranch() {
+		return "", fmt.Errorf("%w: HEAD is detached; check out a branch before syncing", errCacheSyncConflict)
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{RemoteName: remote})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return "", fmt.Errorf("failed to fetch shared cache: %w", err)
+	}
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName(remote, branch.Short()), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		logger.V(1).Info("Debug: Remote branch does not exist yet", "branch", branch.Short())
+		return branch, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve remote branch %s: %w", branch.Short(), err)
+	}
+	if remoteRef.Hash() == head.Hash() {
+		return branch, nil
+	}
+
+	local, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+	upstream, err := repo.CommitObject(remoteRef.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to read remote commit: %w", err)
+	}
+	if ahead, err := upstream.IsAncestor(local); err != nil {
+		return "", fmt.Errorf("failed to compare with remote branch: %w", err)
+	} else if ahead {
+		return branch, nil
+	}
+	if behind, err := local.IsAncestor(upstream); err != nil {
+		return "", fmt.Errorf("failed to compare with remote branch: %w", err)
+	} else if !behind {
+		return "", fmt.Errorf("%w: %s has diverged from %s; merge it before syncing", errCacheSyncConflict, branch.Short(), remote)
+	}
+
+	logger.V(1).Info("Debug: Fast-forwarding to remote branch", "branch", branch.Short(), "commit", remoteRef.Hash().String())
+	if err := worktree.Reset(&git.ResetOptions{Commit: remoteRef.Hash(), Mode: git.MergeReset}); err != nil {
+		return "", fmt.Errorf("failed to fast-forward %s: %w", branch.Short(), err)
+	}
+	return branch, nil
+}
+
+// undoCommit moves the current branch back to the parent of HEAD, keeping the
+// index and working tree.
+func undoCommit(repo *git.Repository, worktree *git.Worktree) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	if commit.NumParents() == 0 {
+		return fmt.Errorf("commit %s has no parent", head.Hash())
+	}
+	return worktree.Reset(&git.ResetOptions{Commit: commit.ParentHashes[0], Mode: git.SoftReset})
+}
+
+// resetToRemote fetches the remote and points the checkout at its branch,
+// discarding anything committed locally that was not pushed; the cache being
+// synced holds those entries anyway. It returns the branch.
+func resetToRemote(ctx context.Context, logger logr.Logger, repo *git.Repository, worktree *git.Worktree, branchName string) (plumbing.ReferenceName, error) {
+	err := repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: cacheSyncRemote,
+		RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/" + cacheSyncRemote + "/*"},
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return "", fmt.Errorf("failed to fetch shared cache: %w", err)
+	}
+
+	if branchName == "" {
+		branchName, err = remoteDefaultBranch(ctx, repo)
+		if err != nil {
+			return "", err
+		}
+	}
+	branch := plumbing.NewBranchReferenceName(branchName)
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch)); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", branchName, err)
+	}
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName(cacheSyncRemote, branchName), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		logger.V(1).Info("Debug: Remote branch does not exist yet", "branch", branchName)
+		return branch, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve remote branch %s: %w", branchName, err)
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, remoteRef.Hash())); err != nil {
+		return "", fmt.Errorf("failed to update %s: %w", branchName, err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: remoteRef.Hash(), Mode: git.HardReset}); err != nil {
+		return "", fmt.Errorf("failed to reset to remote branch %s: %w", branchName, err)
+	}
+	return branch, nil
+}
+
+// remoteDefaultBranch returns the branch the remote's HEAD points at, or
+// "main" if the remote is empty.
+func remoteDefaultBranch(ctx context.Context, repo *git.Repository) (string, error) {
+	remote, err := repo.Remote(cacheSyncRemote)
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache sync remote: %w", err)
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return defaultCacheSyncBranch, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote branches: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+	}
+	return defaultCacheSyncBranch, nil
+}
+
+// commitCacheFile commits file if it changed, reporting whether it did.
+func commitCacheFile(repo *git.Repository, worktree *git.Worktree, file string) (bool, error) {
+	staged, err := worktree.Add(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to stage shared cache: %w", err)
+	}
+	// Worktree.Status reports files rewritten with the same content as
+	// modified, so compare with the committed blob instead.
+	if committed, ok := committedBlob(repo, file); ok && committed == staged {
+		return false, nil
+	}
+
+	signature := cacheSyncSignature(repo)
+	host, _ := os.Hostname()
+	_, err = worktree.Commit(fmt.Sprintf("Update title cache from %s", host), &git.CommitOptions{
+		Author:    signature,
+		Committer: signature,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to commit shared cache: %w", err)
+	}
+	return true, nil
+}
+
+// committedBlob returns the hash of file in the HEAD commit.
+func committedBlob(repo *git.Repository, file string) (plumbing.Hash, bool) {
+	head, err := repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	entry, err := commit.File(file)
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	return entry.Hash, true
+}
+
+// cacheSyncSignature uses the git identity configured for the repository or
+// globally, falling back to hollowbeak on this host.
+func cacheSyncSignature(repo *git.Repository) *object.Signature {
+	signature := &object.Signature{When: time.Now()}
+	if cfg, err := repo.ConfigScoped(config.GlobalScope); err == nil {
+		signature.Name, signature.Email = cfg.User.Name, cfg.User.Email
+	}
+	if signature.Name == "" {
+		signature.Name = "hollowbeak"
+	}
+	if signature.Email == "" {
+		host, _ := os.Hostname()
+		signature.Email = "hollowbeak@" + host
+	}
+	return signature
+}
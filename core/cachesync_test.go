@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-logr/logr/testr"
+)
+
+func TestSyncCache(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "titles.git")
+	if _, err := git.PlainInit(remote, true); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := testr.New(t)
+	newLaptop := func(name string) (*Cache, CacheSyncOptions) {
+		store, err := openJSONCacheStore(logger, filepath.Join(dir, name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newCacheWithStore(logger, store), CacheSyncOptions{
+			Repository:  remote,
+			CheckoutDir: filepath.Join(dir, name+"-checkout"),
+		}
+	}
+	sync := func(cache *Cache, options CacheSyncOptions) CacheSyncResult {
+		t.Helper()
+		result, err := SyncCache(context.Background(), logger, cache, options)
+		if err != nil {
+			t.Fatalf("SyncCache failed: %v", err)
+		}
+		return result
+	}
+
+	now := time.Now()
+	first, firstOptions := newLaptop("first")
+	first.pending["https://a.example/"] = CacheItem{Value: "A", FetchedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	first.pending["https://shared.example/"] = CacheItem{Value: "Old", FetchedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	first.SetFailure("https://gone.example/", "HTTP 404")
+	first.Pin("https://pinned.example/", "Mine")
+	if result := sync(first, firstOptions); !result.Pushed || result.Exported != 2 {
+		t.Errorf("first sync = %+v, want 2 titles pushed to the empty remote", result)
+	}
+
+	second, secondOptions := newLaptop("second")
+	second.pending["https://b.example/"] = CacheItem{Value: "B", FetchedAt: now, ExpiresAt: now.Add(time.Hour)}
+	second.pending["https://shared.example/"] = CacheItem{Value: "New", FetchedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if result := sync(second, secondOptions); result.Imported != 1 || !result.Pushed {
+		t.Errorf("second sync = %+v, want a.example imported and the merge pushed", result)
+	}
+
+	sync(first, firstOptions)
+	want := map[string]string{"https://a.example/": "A", "https://b.example/": "B", "https://shared.example/": "New"}
+	for key, title := range want {
+		if got, _ := first.Get(key); got != title {
+			t.Errorf("title of %s after sync = %q, want %q", key, got, title)
+		}
+	}
+	if _, ok := second.GetFailure("https://gone.example/"); ok {
+		t.Error("failed lookup was shared")
+	}
+	if _, ok := second.Lookup("https://pinned.example/"); ok {
+		t.Error("pinned title was shared")
+	}
+
+	if result := sync(first, firstOptions); result.Committed || result.Pushed {
+		t.Errorf("sync without changes = %+v, want nothing committed", result)
+	}
+}
+
+func TestSyncCacheWithLocalClone(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "titles.git")
+	if _, err := git.PlainInit(remote, true); err != nil {
+		t.Fatal(err)
+	}
+	logger := testr.New(t)
+	newCache := func(name string) *Cache {
+		store, err := openJSONCacheStore(logger, filepath.Join(dir, name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newCacheWithStore(logger, store)
+	}
+
+	now := time.Now()
+	other := newCache("other")
+	other.pending["https://a.example/"] = CacheItem{Value: "A", FetchedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if _, err := SyncCache(context.Background(), logger, other, CacheSyncOptions{Repository: remote, CheckoutDir: filepath.Join(dir, "other-checkout")}); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := filepath.Join(dir, "clone")
+	repo, err := git.PlainClone(clone, false, &git.CloneOptions{URL: remote, ReferenceName: plumbing.NewBranchReferenceName(defaultCacheSyncBranch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(clone, "notes.md"), []byte("draft\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("notes.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	mine := newCache("mine")
+	mine.pending["https://b.example/"] = CacheItem{Value: "B", FetchedAt: now, ExpiresAt: now.Add(time.Hour)}
+	options := CacheSyncOptions{Repository: clone}
+	if _, err := SyncCache(context.Background(), logger, mine, options); err == nil {
+		t.Fatal("sync with another file staged succeeded")
+	}
+
+	if err := worktree.Reset(&git.ResetOptions{Mode: git.MixedReset}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := SyncCache(context.Background(), logger, mine, options)
+	if err != nil {
+		t.Fatalf("SyncCache failed: %v", err)
+	}
+	if result.Imported != 1 || !result.Committed || !result.Pushed {
+		t.Errorf("sync = %+v, want a.example imported and the merge pushed", result)
+	}
+	if got, _ := mine.Get("https://a.example/"); got != "A" {
+		t.Errorf("title pulled from the remote = %q, want %q", got, "A")
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commit.File("notes.md"); err == nil {
+		t.Error("untracked file was committed with the shared cache")
+	}
+	if _, err := os.Stat(filepath.Join(clone, "notes.md")); err != nil {
+		t.Errorf("untracked file was removed: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DefaultTrackingParameters are the query parameters removed from URLs by
+// default. A trailing * matches any parameter with that prefix.
+var DefaultTrackingParameters = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"igshid",
+	"_hsenc",
+	"_hsmi",
+	"mkt_tok",
+}
+
+// CanonicalizeOptions controls how URLs are normalized before they are used as
+// cache keys and deduplicated. The zero value normalizes with the defaults.
+type CanonicalizeOptions struct {
+	// Disabled uses URLs exactly as written.
+	Disabled          bool
+	KeepTrailingSlash bool
+	KeepFragment      bool
+	// TrackingParameters are removed from the query. Nil means
+	// DefaultTrackingParameters; an empty slice keeps every parameter.
+	TrackingParameters []string
+	// RewriteOutput writes canonical URLs to the output instead of the URLs
+	// as they appeared in the input.
+	RewriteOutput bool
+}
+
+// URLCanonicalizer maps the ways a URL is commonly written to a single form:
+// scheme and host in lower case, default ports, trailing slashes, fragments
+// and tracking parameters removed.
+type URLCanonicalizer struct {
+	options  CanonicalizeOptions
+	exact    map[string]bool
+	prefixes []string
+}
+
+func NewURLCanonicalizer(options CanonicalizeOptions) *URLCanonicalizer {
+	params := options.TrackingParameters
+	if params == nil {
+		params = DefaultTrackingParameters
+	}
+
+	c := &URLCanonicalizer{options: options, exact: make(map[string]bool)}
+	for _, param := range params {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			c.prefixes = append(c.prefixes, prefix)
+		} else {
+			c.exact[param] = true
+		}
+	}
+	return c
+}
+
+// Canonicalize returns the canonical form of rawURL. URLs that are not
+// absolute http or https URLs are returned unchanged.
+func (c *URLCanonicalizer) Canonicalize(rawURL string) string {
+	if c == nil || c.options.Disabled {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Opaque != "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return rawURL
+	}
+
+	host, port := u.Hostname(), u.Port()
+	host = strings.ToLower(host)
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	switch {
+	case u.Path == "":
+		u.Path, u.RawPath = "/", ""
+	case !c.options.KeepTrailingSlash && u.Path != "/" && strings.HasSuffix(u.Path, "/"):
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = strings.TrimRight(u.RawPath, "/")
+		if u.Path == "" {
+			u.Path, u.RawPath = "/", ""
+		}
+	}
+
+	if !c.options.KeepFragment {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	u.RawQuery = c.stripTrackingParameters(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// stripTrackingParameters removes tracking parameters from a raw query while
+// leaving the order and encoding of the others alone.
+func (c *URLCanonicalizer) stripTrackingParameters(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	kept := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !c.isTrackingParameter(strings.ToLower(name)) {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func (c *URLCanonicalizer) isTrackingParameter(name string) bool {
+	if c.exact[name] {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
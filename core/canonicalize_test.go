@@ -0,0 +1,35 @@
+package core
+
+import "testing"
+
+func TestURLCanonicalizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CanonicalizeOptions
+		url     string
+		want    string
+	}{
+		{"host case", CanonicalizeOptions{}, "HTTPS://X.com/A", "https://x.com/A"},
+		{"empty path", CanonicalizeOptions{}, "https://x.com", "https://x.com/"},
+		{"default port", CanonicalizeOptions{}, "https://x.com:443/a", "https://x.com/a"},
+		{"other port", CanonicalizeOptions{}, "http://x.com:8080/a", "http://x.com:8080/a"},
+		{"ipv6", CanonicalizeOptions{}, "http://[::1]:80/a", "http://[::1]/a"},
+		{"trailing slash", CanonicalizeOptions{}, "https://x.com/a/", "https://x.com/a"},
+		{"fragment", CanonicalizeOptions{}, "https://x.com/a#frag", "https://x.com/a"},
+		{"tracking parameters", CanonicalizeOptions{}, "https://x.com/a?utm_source=x&id=1&fbclid=2", "https://x.com/a?id=1"},
+		{"only tracking parameters", CanonicalizeOptions{}, "https://x.com/a/?utm_medium=email", "https://x.com/a"},
+		{"keep trailing slash", CanonicalizeOptions{KeepTrailingSlash: true}, "https://x.com/a/", "https://x.com/a/"},
+		{"keep fragment", CanonicalizeOptions{KeepFragment: true}, "https://x.com/#/route", "https://x.com/#/route"},
+		{"custom parameters", CanonicalizeOptions{TrackingParameters: []string{"ref"}}, "https://x.com/?ref=hn&utm_source=x", "https://x.com/?utm_source=x"},
+		{"disabled", CanonicalizeOptions{Disabled: true}, "https://X.com/a/#f", "https://X.com/a/#f"},
+		{"not http", CanonicalizeOptions{}, "ftp://X.com/a/", "ftp://X.com/a/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewURLCanonicalizer(tt.options).Canonicalize(tt.url); got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
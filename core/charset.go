@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/saintfish/chardet"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	charsetSniffLength = 4096
+	// metaPrescanLength is how far into a document a <meta> charset
+	// declaration is looked for, as in the HTML5 prescan.
+	metaPrescanLength = 1024
+	// minSniffConfidence is the chardet confidence (0-100) required before a
+	// sniffed charset overrides the HTML5 default.
+	minSniffConfidence = 50
+)
+
+// newUTF8Reader returns a reader that transcodes an HTML document to UTF-8.
+// The encoding is taken from a byte order mark, the Content-Type header or a
+// <meta> charset declaration, in that order, and is otherwise sniffed from
+// the start of the document.
+func newUTF8Reader(logger logr.Logger, reader io.Reader, contentType string) io.Reader {
+	buffered := bufio.NewReaderSize(reader, charsetSniffLength)
+	// A short read just means a short document; sniff what there is.
+	prefix, _ := buffered.Peek(charsetSniffLength)
+
+	enc, name, certain := charset.DetermineEncoding(prefix, contentType)
+	// DetermineEncoding is only certain of a byte order mark or the header.
+	// A <meta> declaration still takes precedence over sniffing, but it does
+	// not say whether its guess came from one, so look for it again.
+	if !certain {
+		if declared, declaredName := metaCharset(prefix); declared != nil {
+			enc, name, certain = declared, declaredName, true
+		}
+	}
+	if !certain {
+		if result, err := chardet.NewHtmlDetector().DetectBest(prefix); err == nil && result.Confidence >= minSniffConfidence {
+			if sniffed, err := htmlindex.Get(result.Charset); err == nil {
+				enc = sniffed
+				name = result.Charset
+			}
+		}
+	}
+	logger.V(2).Info("Debug: Determined document charset", "charset", name, "certain", certain)
+
+	// BOMOverride strips a byte order mark, which DetermineEncoding honors but
+	// the returned decoder would otherwise pass through.
+	return transform.NewReader(buffered, unicode.BOMOverride(enc.NewDecoder()))
+}
+
+// metaCharset returns the encoding declared by a <meta charset> or <meta
+// http-equiv="Content-Type"> element near the start of a document, if any.
+func metaCharset(prefix []byte) (encoding.Encoding, string) {
+	if len(prefix) > metaPrescanLength {
+		prefix = prefix[:metaPrescanLength]
+	}
+	tokenizer := html.NewTokenizer(bytes.NewReader(prefix))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return nil, ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "meta" {
+				continue
+			}
+			var declared, httpEquiv, content string
+			for _, a := range token.Attr {
+				switch strings.ToLower(a.Key) {
+				case "charset":
+					declared = a.Val
+				case "http-equiv":
+					httpEquiv = a.Val
+				case "content":
+					content = a.Val
+				}
+			}
+			if declared == "" && strings.EqualFold(httpEquiv, "content-type") {
+				if _, params, err := mime.ParseMediaType(content); err == nil {
+					declared = params["charset"]
+				}
+			}
+			if declared == "" {
+				continue
+			}
+			enc, name := charset.Lookup(strings.TrimSpace(declared))
+			if enc == nil {
+				continue
+			}
+			// A document that could be read far enough to find the
+			// declaration cannot be UTF-16, so HTML5 reads it as UTF-8.
+			if strings.HasPrefix(name, "utf-16") {
+				enc, name = charset.Lookup("utf-8")
+			}
+			return enc, name
+		}
+	}
+}
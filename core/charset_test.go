@@ -0,0 +1,75 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	out, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("failed to encode test document: %v", err)
+	}
+	return out
+}
+
+func TestNewUTF8Reader(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		want        string
+	}{
+		{
+			name:        "content-type header",
+			body:        encode(t, japanese.ShiftJIS, "<title>日本語のタイトル</title>"),
+			contentType: "text/html; charset=Shift_JIS",
+			want:        "<title>日本語のタイトル</title>",
+		},
+		{
+			name:        "meta charset",
+			body:        encode(t, charmap.Windows1252, `<meta charset="windows-1252"><title>Café “quotes”</title>`),
+			contentType: "text/html",
+			want:        `<meta charset="windows-1252"><title>Café “quotes”</title>`,
+		},
+		{
+			name:        "meta charset euc-kr",
+			body:        encode(t, korean.EUCKR, `<meta charset="euc-kr"><title>한국어 페이지 제목입니다</title>`),
+			contentType: "text/html",
+			want:        `<meta charset="euc-kr"><title>한국어 페이지 제목입니다</title>`,
+		},
+		{
+			name:        "meta http-equiv gbk",
+			body:        encode(t, simplifiedchinese.GBK, `<meta http-equiv="Content-Type" content="text/html; charset=gbk"><title>中文网页标题</title>`),
+			contentType: "text/html",
+			want:        `<meta http-equiv="Content-Type" content="text/html; charset=gbk"><title>中文网页标题</title>`,
+		},
+		{
+			name:        "byte order mark",
+			body:        append([]byte("\xef\xbb\xbf"), "<title>Grüße</title>"...),
+			contentType: "text/html; charset=iso-8859-1",
+			want:        "<title>Grüße</title>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(newUTF8Reader(testr.New(t), bytes.NewReader(tt.body), tt.contentType))
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/go-logr/logr"
+)
+
+type chromiumBrowser struct {
+	name string
+	// userDataDir is the browser's user data directory relative to the
+	// platform's per-user configuration directory.
+	userDataDir string
+}
+
+func chromiumBrowsers() []chromiumBrowser {
+	switch runtime.GOOS {
+	case "darwin":
+		return []chromiumBrowser{
+			{name: "chrome", userDataDir: "Google/Chrome"},
+			{name: "chromium", userDataDir: "Chromium"},
+			{name: "brave", userDataDir: "BraveSoftware/Brave-Browser"},
+			{name: "edge", userDataDir: "Microsoft Edge"},
+			{name: "vivaldi", userDataDir: "Vivaldi"},
+		}
+	case "windows":
+		return []chromiumBrowser{
+			{name: "chrome", userDataDir: "Google/Chrome/User Data"},
+			{name: "chromium", userDataDir: "Chromium/User Data"},
+			{name: "brave", userDataDir: "BraveSoftware/Brave-Browser/User Data"},
+			{name: "edge", userDataDir: "Microsoft/Edge/User Data"},
+			{name: "vivaldi", userDataDir: "Vivaldi/User Data"},
+		}
+	default:
+		return []chromiumBrowser{
+			{name: "chrome", userDataDir: "google-chrome"},
+			{name: "chromium", userDataDir: "chromium"},
+			{name: "brave", userDataDir: "BraveSoftware/Brave-Browser"},
+			{name: "edge", userDataDir: "microsoft-edge"},
+			{name: "vivaldi", userDataDir: "vivaldi"},
+		}
+	}
+}
+
+// discoverChromiumHistoryFiles returns the History database of every profile
+// of every installed Chromium-family browser.
+func discoverChromiumHistoryFiles(logger logr.Logger) []string {
+	var historyFiles []string
+	for _, browser := range chromiumBrowsers() {
+		userDataDir := filepath.Join(xdg.ConfigHome, filepath.FromSlash(browser.userDataDir))
+		files := findChromiumProfileHistories(userDataDir)
+		logger.V(2).Info("Debug: Discovered Chromium history files", "browser", browser.name, "dir", userDataDir, "count", len(files))
+		historyFiles = append(historyFiles, files...)
+	}
+	return historyFiles
+}
+
+func findChromiumProfileHistories(userDataDir string) []string {
+	entries, err := os.ReadDir(userDataDir)
+	if err != nil {
+		return nil
+	}
+
+	var profiles []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if name == "Default" || strings.HasPrefix(name, "Profile ") {
+			profiles = append(profiles, name)
+		}
+	}
+	sort.Strings(profiles)
+
+	var historyFiles []string
+	for _, profile := range profiles {
+		historyFile := filepath.Join(userDataDir, profile, "History")
+		if info, err := os.Stat(historyFile); err == nil && info.Mode().IsRegular() {
+			historyFiles = append(historyFiles, historyFile)
+		}
+	}
+	return historyFiles
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindChromiumProfileHistories(t *testing.T) {
+	userDataDir := t.TempDir()
+
+	for _, profile := range []string{"Default", "Profile 1", "Profile 2", "System Profile", "Guest Profile"} {
+		if err := os.MkdirAll(filepath.Join(userDataDir, profile), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, profile := range []string{"Default", "Profile 2", "System Profile"} {
+		if err := os.WriteFile(filepath.Join(userDataDir, profile, "History"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := findChromiumProfileHistories(userDataDir)
+	want := []string{
+		filepath.Join(userDataDir, "Default", "History"),
+		filepath.Join(userDataDir, "Profile 2", "History"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// HTTPStatusError is returned when a URL answers with a non-2xx status. The
+// body of such a response is an error page and never yields a title.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay requested by a Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s returned HTTP %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func isSuccessStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+func checkHTTPStatus(url string, statusCode int, header http.Header) error {
+	if isSuccessStatus(statusCode) {
+		return nil
+	}
+	return &HTTPStatusError{
+		URL:        url,
+		StatusCode: statusCode,
+		RetryAfter: parseRetryAfter(header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// CachedFailureError is reported for a URL whose last lookup failed recently
+// enough that the failure is still cached.
+type CachedFailureError struct {
+	URL    string
+	Reason string
+}
+
+func (e *CachedFailureError) Error() string {
+	return fmt.Sprintf("%s failed recently (cached): %s", e.URL, e.Reason)
+}
+
+// StatusCodeOf returns the HTTP status code carried by err, or 0 if err did
+// not come from a non-2xx response.
+func StatusCodeOf(err error) int {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// isHTMLContentType reports whether a Content-Type header describes an HTML
+// document. A missing header is given the benefit of the doubt.
+func isHTMLContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fileLockTimeout  = 10 * time.Second
+	fileLockStaleAge = 30 * time.Second
+	fileLockPoll     = 25 * time.Millisecond
+)
+
+// fileLock is an advisory lock shared between processes, held by creating a
+// lock file exclusively. It works the same on every platform, which flock and
+// LockFileEx do not. A lock file left behind by a crashed process is taken
+// over once it is older than fileLockStaleAge. The file holds a token unique
+// to its holder, so that a lock that was taken over is not released by the
+// process it was taken from.
+type fileLock struct {
+	path  string
+	token string
+}
+
+func acquireFileLock(path string) (*fileLock, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	token := strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(random)
+
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintln(f, token)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+			return &fileLock{path: path, token: token}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > fileLockStaleAge {
+			took, err := takeOverStaleLock(path, token)
+			if err != nil {
+				return nil, err
+			}
+			if took {
+				return &fileLock{path: path, token: token}, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(fileLockPoll)
+	}
+}
+
+// takeOverStaleLock replaces the lock file at path with one holding token if
+// it is still stale. The new lock is written under a temporary name and renamed
+// over the stale one, so the lock file never goes missing and no other waiter
+// can create it in between. Takeovers and releases hold the guard file, so the
+// lock cannot change between the staleness check and the rename.
+func takeOverStaleLock(path, token string) (bool, error) {
+	unlock, err := lockGuard(path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) <= fileLockStaleAge {
+		return false, nil
+	}
+
+	tmp := path + "." + token + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token+"\n"), 0o644); err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("failed to take over stale lock: %w", err)
+	}
+	return true, nil
+}
+
+// lockGuard creates the guard file serialising takeovers and releases of the
+// lock at path and returns a function that removes it. The guard is only held
+// for a few file operations, so one older than fileLockStaleAge was left
+// behind by a crashed process and is removed.
+func lockGuard(path string) (func(), error) {
+	guard := path + ".guard"
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		f, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(guard) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock guard: %w", err)
+		}
+
+		if info, err := os.Stat(guard); err == nil && time.Since(info.ModTime()) > fileLockStaleAge {
+			os.Remove(guard)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock guard %s", guard)
+		}
+		time.Sleep(fileLockPoll)
+	}
+}
+
+// release removes the lock file, unless the lock was taken over.
+func (l *fileLock) release() error {
+	unlock, err := lockGuard(l.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read lock file: %w", err)
+	}
+	if strings.TrimSpace(string(content)) != l.token {
+		return fmt.Errorf("lock %s was taken over by another process", l.path)
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file in the
+// same directory and renaming it over path, so readers never see a partially
+// written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileLockTakeOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json.lock")
+
+	stale, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * fileLockStaleAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("stale lock was not taken over: %v", err)
+	}
+	if err := stale.release(); err == nil {
+		t.Error("releasing a lock that was taken over succeeded")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("releasing the stale lock removed the current one: %v", err)
+	}
+
+	if err := current.release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after release: %v", err)
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+		t.Errorf("left behind %v", matches)
+	}
+}
+
+func TestFileLockConcurrentTakeOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json.lock")
+	old := time.Now().Add(-2 * fileLockStaleAge)
+
+	for round := 0; round < 50; round++ {
+		if err := os.WriteFile(path, []byte("crashed\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		var winners atomic.Int32
+		var winner atomic.Value
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			token := fmt.Sprintf("waiter-%d", i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				took, err := takeOverStaleLock(path, token)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if took {
+					winners.Add(1)
+					winner.Store(token)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if n := winners.Load(); n != 1 {
+			t.Fatalf("round %d: %d waiters took over the stale lock, want 1", round, n)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(content)); got != winner.Load() {
+			t.Fatalf("round %d: lock file holds %q, want the winner %q", round, got, winner.Load())
+		}
+		if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+			t.Fatalf("round %d: left behind %v", round, matches)
+		}
+	}
+}
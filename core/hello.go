@@ -1,10 +1,13 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -12,26 +15,59 @@ import (
 type URLInfo struct {
 	URL   string
 	Title string
+	// FinalURL is where URL led after redirects. It is empty when the title
+	// did not come from a fetch, e.g. from browser history.
+	FinalURL    string
+	StatusCode  int
+	ContentType string
+	Description string
+	// Fetcher is the fetcher that produced Title, "cache" or "override".
+	Fetcher  string
+	Duration time.Duration
+	// Err is the reason no title could be resolved, if known.
+	Err error
+}
+
+// FetcherOptions holds settings that are passed through to the title fetchers.
+type FetcherOptions struct {
+	// HistoryFiles overrides Chromium history discovery for the sql fetcher.
+	HistoryFiles []string
+	Concurrency  ConcurrencyLimits
+	Retries      RetryPolicies
+	// MaxBodyBytes caps how much of each response body is read.
+	MaxBodyBytes int64
+	// TitleSources is the precedence of page metadata used for titles by the
+	// http and colly fetchers.
+	TitleSources []string
+	Cache        CacheOptions
 }
 
 func FetchURLTitles(
+	ctx context.Context,
 	logger logr.Logger,
 	reader io.Reader,
 	outputFormat string,
 	fetcherTypes []string,
 	noCache bool,
+	options FetcherOptions,
 ) error {
 	logger.V(1).Info("Debug: Entering Hello function")
 
+	if err := ValidateTitleSources(options.TitleSources); err != nil {
+		return err
+	}
+
 	var titleFetchers []TitleFetcher
 	for _, fetcherType := range fetcherTypes {
 		switch fetcherType {
 		case "http":
-			titleFetchers = append(titleFetchers, NewHTTPTitleFetcher(logger))
+			titleFetchers = append(titleFetchers, NewHTTPTitleFetcher(logger, options))
 		case "colly":
-			titleFetchers = append(titleFetchers, NewCollyTitleFetcher(logger))
+			titleFetchers = append(titleFetchers, NewCollyTitleFetcher(logger, options))
 		case "sql":
-			titleFetchers = append(titleFetchers, NewSQLTitleFetcher(logger))
+			titleFetchers = append(titleFetchers, NewSQLTitleFetcher(logger, options.HistoryFiles))
+		case "firefox":
+			titleFetchers = append(titleFetchers, NewFirefoxTitleFetcher(logger))
 		default:
 			return fmt.Errorf("invalid fetcher type: %s", fetcherType)
 		}
@@ -42,7 +78,7 @@ func FetchURLTitles(
 	}
 
 	logger.V(1).Info("Debug: Creating new URLExtractor")
-	extractor, err := NewURLExtractor(logger, reader, titleFetchers, noCache)
+	extractor, err := NewURLExtractor(logger, reader, titleFetchers, noCache, options.Cache)
 	if err != nil {
 		return fmt.Errorf("failed to create URLExtractor: %w", err)
 	}
@@ -54,14 +90,19 @@ func FetchURLTitles(
 			if err := extractor.cache.CleanupAndSave(); err != nil {
 				logger.Error(err, "Failed to cleanup and save cache")
 			}
+			if err := extractor.cache.Close(); err != nil {
+				logger.Error(err, "Failed to close cache")
+			}
 		}
 	}()
 
-	urlInfoList, err := BuildURLInfoList(logger, extractor)
+	urlInfoList, err := BuildURLInfoList(ctx, logger, extractor)
 	if err != nil {
 		return fmt.Errorf("failed to build URL info list: %w", err)
 	}
 
+	reportFailures(logger, urlInfoList)
+
 	var output string
 	switch outputFormat {
 	case "markdown":
@@ -70,6 +111,11 @@ func FetchURLTitles(
 		output = GenerateHTML(urlInfoList)
 	case "space":
 		output = GenerateSpaceDelimited(urlInfoList)
+	case "json":
+		output, err = GenerateJSON(urlInfoList)
+		if err != nil {
+			return fmt.Errorf("failed to generate JSON: %w", err)
+		}
 	default:
 		return fmt.Errorf("invalid output format: %s", outputFormat)
 	}
@@ -83,7 +129,7 @@ func FetchURLTitles(
 	return nil
 }
 
-func BuildURLInfoList(logger logr.Logger, extractor *URLExtractor) ([]URLInfo, error) {
+func BuildURLInfoList(ctx context.Context, logger logr.Logger, extractor *URLExtractor) ([]URLInfo, error) {
 	logger.V(1).Info("Debug: Extracting URLs from file")
 	urls, err := extractor.ExtractURLs()
 	if err != nil {
@@ -91,21 +137,44 @@ func BuildURLInfoList(logger logr.Logger, extractor *URLExtractor) ([]URLInfo, e
 	}
 	logger.V(2).Info("Debug: URLs extracted", "count", len(urls))
 
-	titles, err := extractor.GetOrFetchTitles(urls)
+	titles, err := extractor.GetOrFetchTitles(ctx, urls)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get or fetch titles: %w", err)
 	}
 
 	var urlInfoList []URLInfo
 	for _, url := range urls {
-		title := titles[url.URL]
-		logger.V(2).Info("Title", "url", url.URL, "title", title)
-		urlInfoList = append(urlInfoList, URLInfo{URL: url.URL, Title: title})
+		result := titles[url.URL]
+		logger.V(2).Info("Title", "url", url.URL, "title", result.Title)
+		urlInfoList = append(urlInfoList, URLInfo{
+			URL:         extractor.outputURL(url.URL),
+			Title:       result.Title,
+			FinalURL:    result.FinalURL,
+			StatusCode:  result.StatusCode,
+			ContentType: result.ContentType,
+			Description: result.Description,
+			Fetcher:     result.Fetcher,
+			Duration:    result.Duration,
+			Err:         result.Err,
+		})
 	}
 
 	return urlInfoList, nil
 }
 
+func reportFailures(logger logr.Logger, urlInfoList []URLInfo) {
+	for _, info := range urlInfoList {
+		if info.Err == nil {
+			continue
+		}
+		if statusCode := StatusCodeOf(info.Err); statusCode != 0 {
+			logger.Info("Failed to resolve title", "url", info.URL, "status", statusCode, "error", info.Err.Error())
+		} else {
+			logger.Info("Failed to resolve title", "url", info.URL, "error", info.Err.Error())
+		}
+	}
+}
+
 func GenerateMarkdown(urlInfoList []URLInfo) string {
 	var sb strings.Builder
 	for _, info := range urlInfoList {
@@ -131,3 +200,43 @@ func GenerateHTML(urlInfoList []URLInfo) string {
 	sb.WriteString("</ul>")
 	return sb.String()
 }
+
+type jsonURLInfo struct {
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	FinalURL    string  `json:"finalUrl,omitempty"`
+	StatusCode  int     `json:"status,omitempty"`
+	ContentType string  `json:"contentType,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Fetcher     string  `json:"fetcher,omitempty"`
+	DurationMS  float64 `json:"durationMs,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// GenerateJSON renders the list as a JSON array that, unlike the other
+// formats, also carries the fetch metadata of each URL.
+func GenerateJSON(urlInfoList []URLInfo) (string, error) {
+	entries := make([]jsonURLInfo, 0, len(urlInfoList))
+	for _, info := range urlInfoList {
+		entry := jsonURLInfo{
+			URL:         info.URL,
+			Title:       info.Title,
+			FinalURL:    info.FinalURL,
+			StatusCode:  info.StatusCode,
+			ContentType: info.ContentType,
+			Description: info.Description,
+			Fetcher:     info.Fetcher,
+			DurationMS:  float64(info.Duration.Microseconds()) / 1000,
+		}
+		if info.Err != nil {
+			entry.Error = info.Err.Error()
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
@@ -1,16 +1,161 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 
 	"github.com/go-logr/logr"
 	"golang.org/x/net/html"
 )
 
-func extractTitle(logger logr.Logger, reader io.Reader) (string, error) {
-	logger.V(1).Info("Debug: Entering extractTitle function")
+const (
+	TitleSourceTitle        = "title"
+	TitleSourceOGTitle      = "og:title"
+	TitleSourceTwitterTitle = "twitter:title"
+	TitleSourceJSONLD       = "json-ld"
+	TitleSourceOGSiteName   = "og:site_name"
+)
+
+// DefaultTitleSources is the order in which page metadata is consulted for a
+// title. Social and structured metadata come first because many single-page
+// apps and news sites ship a generic <title>.
+var DefaultTitleSources = []string{
+	TitleSourceOGTitle,
+	TitleSourceTwitterTitle,
+	TitleSourceJSONLD,
+	TitleSourceTitle,
+	TitleSourceOGSiteName,
+}
+
+// ValidateTitleSources returns an error if any source is not a known title
+// source.
+func ValidateTitleSources(sources []string) error {
+	for _, source := range sources {
+		switch source {
+		case TitleSourceTitle, TitleSourceOGTitle, TitleSourceTwitterTitle, TitleSourceJSONLD, TitleSourceOGSiteName:
+		default:
+			return fmt.Errorf("invalid title source: %s", source)
+		}
+	}
+	return nil
+}
+
+// PageMetadata holds the title candidates found in an HTML document.
+type PageMetadata struct {
+	Title        string
+	OGTitle      string
+	TwitterTitle string
+	OGSiteName   string
+	JSONLDTitle  string
+	// Description, OGDescription and TwitterDescription are the page's
+	// summaries from <meta name="description"> and its social variants.
+	Description        string
+	OGDescription      string
+	TwitterDescription string
+	// ChallengeMarker names the bot-challenge markup found in the page, if any.
+	ChallengeMarker string
+}
+
+// TitleFrom returns the first non-empty candidate in sources order.
+func (m PageMetadata) TitleFrom(sources []string) string {
+	for _, source := range sources {
+		var title string
+		switch source {
+		case TitleSourceTitle:
+			title = m.Title
+		case TitleSourceOGTitle:
+			title = m.OGTitle
+		case TitleSourceTwitterTitle:
+			title = m.TwitterTitle
+		case TitleSourceJSONLD:
+			title = m.JSONLDTitle
+		case TitleSourceOGSiteName:
+			title = m.OGSiteName
+		}
+		if title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// BestDescription returns the first non-empty description, preferring the
+// plain meta description over its social variants.
+func (m PageMetadata) BestDescription() string {
+	for _, description := range []string{m.Description, m.OGDescription, m.TwitterDescription} {
+		if description != "" {
+			return description
+		}
+	}
+	return ""
+}
+
+// responseInfo describes the HTTP response an HTML document was read from.
+type responseInfo struct {
+	RequestURL string
+	// FinalURL is the URL the document was served from after redirects.
+	FinalURL string
+	// ContentType is the Content-Type header, used to determine the
+	// document's charset.
+	ContentType string
+}
+
+// pageSummary is what is kept of an HTML document.
+type pageSummary struct {
+	Title       string
+	Description string
+}
+
+// extractTitle reads an HTML document in any character encoding and returns
+// the first title found among sources. Bot challenges, consent walls and login
+// redirects yield an *InterstitialError instead of their placeholder title.
+func extractTitle(logger logr.Logger, reader io.Reader, resp responseInfo, sources []string) (string, error) {
+	summary, err := summarizePage(logger, reader, resp, sources)
+	return summary.Title, err
+}
+
+// summarizePage is extractTitle, also returning the page description.
+func summarizePage(logger logr.Logger, reader io.Reader, resp responseInfo, sources []string) (pageSummary, error) {
+	logger.V(1).Info("Debug: Entering summarizePage function")
+
+	if len(sources) == 0 {
+		sources = DefaultTitleSources
+	}
+
+	metadata, err := extractPageMetadata(logger, newUTF8Reader(logger, reader, resp.ContentType), sources)
+	if err != nil {
+		return pageSummary{}, err
+	}
+
+	if err := detectInterstitial(resp, metadata); err != nil {
+		logger.V(1).Info("Debug: Detected interstitial page", "url", resp.RequestURL, "reason", err.Error())
+		return pageSummary{}, err
+	}
+
+	title := metadata.TitleFrom(sources)
+	if title == "" {
+		logger.V(2).Info("Debug: Reached end of HTML document without finding title")
+		return pageSummary{}, fmt.Errorf("reached end of HTML document without finding title: %w", io.EOF)
+	}
+
+	logger.V(1).Info("Debug: Extracted title", "title", title)
+	return pageSummary{Title: title, Description: metadata.BestDescription()}, nil
+}
+
+// extractPageMetadata tokenizes an HTML document and collects its title
+// candidates. Reading stops at the end of the document head once a title is
+// available from sources, so the body of most pages is never downloaded.
+func extractPageMetadata(logger logr.Logger, reader io.Reader, sources []string) (PageMetadata, error) {
+	var metadata PageMetadata
+	// A <title> in the document head is authoritative. One found later in the
+	// body is only used when the head has none, and <title> elements inside
+	// inline SVG or MathML are never the page title.
+	var bodyTitle string
+	inBody := false
+	foreignDepth := 0
 
 	logger.V(2).Info("Debug: Creating HTML tokenizer")
 	tokenizer := html.NewTokenizer(reader)
@@ -23,30 +168,204 @@ func extractTitle(logger logr.Logger, reader io.Reader) (string, error) {
 
 		switch tokenType {
 		case html.ErrorToken:
-			logger.V(2).Info("Debug: Reached end of HTML document or encountered an error")
 			err := tokenizer.Err()
 			if err == io.EOF {
-				logger.V(2).Info("Debug: Reached end of HTML document without finding title")
-				return "", fmt.Errorf("reached end of HTML document without finding title: %w", io.EOF)
+				logger.V(2).Info("Debug: Reached end of HTML document")
+				if metadata.Title == "" {
+					metadata.Title = bodyTitle
+				}
+				return metadata, nil
 			}
 			logger.Error(err, "Error while tokenizing HTML")
-			return "", fmt.Errorf("error while tokenizing HTML: %w", err)
+			return metadata, fmt.Errorf("error while tokenizing HTML: %w", err)
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "head":
+				inBody = true
+				if metadata.TitleFrom(sources) != "" {
+					logger.V(2).Info("Debug: Title found in head, not reading body")
+					return metadata, nil
+				}
+			case "svg", "math":
+				if foreignDepth > 0 {
+					foreignDepth--
+				}
+			}
 
 		case html.StartTagToken, html.SelfClosingTagToken:
 			token := tokenizer.Token()
 			logger.V(3).Info("Debug: Found start/self-closing tag", "tag", token.Data)
 
-			if token.Data == "title" {
-				logger.V(2).Info("Debug: Found title tag")
-				tokenType = tokenizer.Next()
-				if tokenType == html.TextToken {
-					title := strings.TrimSpace(tokenizer.Token().Data)
-					logger.V(1).Info("Debug: Extracted title", "title", title)
-					return title, nil
+			if metadata.ChallengeMarker == "" {
+				metadata.ChallengeMarker = findChallengeMarker(token)
+			}
+
+			switch token.Data {
+			case "body":
+				inBody = true
+				if metadata.TitleFrom(sources) != "" {
+					logger.V(2).Info("Debug: Title found in head, not reading body")
+					return metadata, nil
 				}
-				logger.V(2).Info("Debug: Title tag was empty or contained non-text content")
-				return "", fmt.Errorf("title tag was empty or contained non-text content")
+
+			case "svg", "math":
+				if tokenType == html.StartTagToken {
+					foreignDepth++
+				}
+
+			case "title":
+				if tokenType == html.SelfClosingTagToken {
+					continue
+				}
+				title := readElementText(tokenizer, "title")
+				switch {
+				case foreignDepth > 0:
+					logger.V(3).Info("Debug: Skipping title inside SVG or MathML", "title", title)
+				case !inBody && metadata.Title == "":
+					metadata.Title = title
+					logger.V(2).Info("Debug: Found title tag", "title", metadata.Title)
+				case inBody && bodyTitle == "":
+					bodyTitle = title
+					logger.V(2).Info("Debug: Found title tag outside head", "title", bodyTitle)
+				}
+
+			case "meta":
+				readMetaTag(token, &metadata)
+
+			case "script":
+				if attr(token, "type") != "application/ld+json" || metadata.JSONLDTitle != "" {
+					continue
+				}
+				metadata.JSONLDTitle = jsonLDTitle(readElementText(tokenizer, "script"))
+				logger.V(2).Info("Debug: Found JSON-LD title", "title", metadata.JSONLDTitle)
+			}
+		}
+	}
+}
+
+// readElementText consumes tokens up to the end tag of the element named tag
+// and returns its text content with entities decoded and whitespace collapsed.
+func readElementText(tokenizer *html.Tokenizer, tag string) string {
+	var sb strings.Builder
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return normalizeText(sb.String())
+		case html.TextToken:
+			sb.Write(tokenizer.Text())
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == tag {
+				return normalizeText(sb.String())
+			}
+		}
+	}
+}
+
+// normalizeText collapses runs of whitespace, including newlines and
+// non-breaking spaces, into single spaces.
+func normalizeText(s string) string {
+	return strings.Join(strings.FieldsFunc(s, unicode.IsSpace), " ")
+}
+
+func readMetaTag(token html.Token, metadata *PageMetadata) {
+	key := attr(token, "property")
+	if key == "" {
+		key = attr(token, "name")
+	}
+	content := normalizeText(attr(token, "content"))
+	if content == "" {
+		return
+	}
+
+	var field *string
+	switch strings.ToLower(key) {
+	case "og:title":
+		field = &metadata.OGTitle
+	case "twitter:title":
+		field = &metadata.TwitterTitle
+	case "og:site_name":
+		field = &metadata.OGSiteName
+	case "description":
+		field = &metadata.Description
+	case "og:description":
+		field = &metadata.OGDescription
+	case "twitter:description":
+		field = &metadata.TwitterDescription
+	default:
+		return
+	}
+	if *field == "" {
+		*field = content
+	}
+}
+
+func attr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// jsonLDTitle returns the headline of the first schema.org node that has one,
+// or else the name of the first node describing the page itself rather than
+// its publisher or author.
+func jsonLDTitle(data string) string {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return ""
+	}
+
+	nodes := flattenJSONLD(doc)
+	for _, node := range nodes {
+		if headline, ok := node["headline"].(string); ok && strings.TrimSpace(headline) != "" {
+			return strings.TrimSpace(headline)
+		}
+	}
+	for _, node := range nodes {
+		if isJSONLDEntityType(node["@type"]) {
+			continue
+		}
+		if name, ok := node["name"].(string); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+func flattenJSONLD(doc interface{}) []map[string]interface{} {
+	var nodes []map[string]interface{}
+	switch v := doc.(type) {
+	case []interface{}:
+		for _, item := range v {
+			nodes = append(nodes, flattenJSONLD(item)...)
+		}
+	case map[string]interface{}:
+		nodes = append(nodes, v)
+		if graph, ok := v["@graph"]; ok {
+			nodes = append(nodes, flattenJSONLD(graph)...)
+		}
+	}
+	return nodes
+}
+
+func isJSONLDEntityType(t interface{}) bool {
+	switch v := t.(type) {
+	case string:
+		switch v {
+		case "Organization", "NewsMediaOrganization", "Person", "WebSite", "BreadcrumbList", "ImageObject", "SiteNavigationElement":
+			return true
+		}
+	case []interface{}:
+		for _, item := range v {
+			if isJSONLDEntityType(item) {
+				return true
 			}
 		}
 	}
+	return false
 }
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestExtractPageMetadata(t *testing.T) {
+	page := `<!doctype html>
+<html>
+<head>
+  <title>Home</title>
+  <meta property="og:title" content="Open Graph Title">
+  <meta name="twitter:title" content="Twitter Title">
+  <meta property="og:site_name" content="Example News">
+  <meta property="og:description" content="Open Graph  description">
+  <script type="application/ld+json">
+  {"@context": "https://schema.org", "@graph": [
+    {"@type": "Organization", "name": "Example Corp"},
+    {"@type": "NewsArticle", "headline": "JSON-LD Headline"}
+  ]}
+  </script>
+</head>
+<body></body>
+</html>`
+
+	metadata, err := extractPageMetadata(testr.New(t), strings.NewReader(page), DefaultTitleSources)
+	if err != nil {
+		t.Fatalf("extractPageMetadata failed: %v", err)
+	}
+
+	want := PageMetadata{
+		Title:         "Home",
+		OGTitle:       "Open Graph Title",
+		TwitterTitle:  "Twitter Title",
+		OGSiteName:    "Example News",
+		JSONLDTitle:   "JSON-LD Headline",
+		OGDescription: "Open Graph description",
+	}
+	if metadata != want {
+		t.Errorf("got %+v, want %+v", metadata, want)
+	}
+	if got := metadata.BestDescription(); got != want.OGDescription {
+		t.Errorf("BestDescription() = %q, want %q", got, want.OGDescription)
+	}
+}
+
+func TestExtractTitlePrecedence(t *testing.T) {
+	page := `<html><head><title>Loading…</title><meta name="twitter:title" content="Real Title"></head></html>`
+
+	tests := []struct {
+		sources []string
+		want    string
+	}{
+		{nil, "Real Title"},
+		{[]string{TitleSourceTitle, TitleSourceTwitterTitle}, "Loading…"},
+		{[]string{TitleSourceOGTitle, TitleSourceTwitterTitle}, "Real Title"},
+	}
+
+	for _, tt := range tests {
+		got, err := extractTitle(testr.New(t), strings.NewReader(page), responseInfo{ContentType: "text/html; charset=utf-8"}, tt.sources)
+		if err != nil {
+			t.Fatalf("extractTitle(%v) failed: %v", tt.sources, err)
+		}
+		if got != tt.want {
+			t.Errorf("extractTitle(%v) = %q, want %q", tt.sources, got, tt.want)
+		}
+	}
+
+	if _, err := extractTitle(testr.New(t), strings.NewReader(page), responseInfo{ContentType: "text/html; charset=utf-8"}, []string{TitleSourceJSONLD}); err == nil {
+		t.Error("expected an error when no requested source is present")
+	}
+}
+
+func TestJSONLDTitleFallsBackToName(t *testing.T) {
+	data := `[{"@type": "WebSite", "name": "Example"}, {"@type": "Product", "name": "Widget 3000"}]`
+	if got := jsonLDTitle(data); got != "Widget 3000" {
+		t.Errorf("jsonLDTitle = %q, want %q", got, "Widget 3000")
+	}
+}
+
+func TestExtractPageMetadataTitleScoping(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "inline svg title before head title is ignored",
+			page: `<html><head><svg><title>Icon</title></svg><title>Page</title></head></html>`,
+			want: "Page",
+		},
+		{
+			name: "body svg title does not shadow head title",
+			page: `<html><head><title>Page</title></head><body><svg><title>Icon</title></svg></body></html>`,
+			want: "Page",
+		},
+		{
+			name: "body title is a fallback",
+			page: `<html><body><svg><title>Icon</title></svg><title>Late Title</title></body></html>`,
+			want: "Late Title",
+		},
+		{
+			name: "entities and whitespace are normalized",
+			page: "<title>\n  Tom &amp; Jerry&nbsp;&mdash;\n  The\tMovie  </title>",
+			want: "Tom & Jerry — The Movie",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := extractPageMetadata(testr.New(t), strings.NewReader(tt.page), DefaultTitleSources)
+			if err != nil {
+				t.Fatalf("extractPageMetadata failed: %v", err)
+			}
+			if metadata.Title != tt.want {
+				t.Errorf("got %q, want %q", metadata.Title, tt.want)
+			}
+		})
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestExtractTitleStopsReadingAfterHead(t *testing.T) {
+	body := strings.Repeat("<p>filler</p>", 100_000)
+	page := "<html><head><title>Early</title></head><body>" + body + "</body></html>"
+	reader := &countingReader{r: strings.NewReader(page)}
+
+	title, err := extractTitle(testr.New(t), reader, responseInfo{ContentType: "text/html; charset=utf-8"}, []string{TitleSourceTitle})
+	if err != nil {
+		t.Fatalf("extractTitle failed: %v", err)
+	}
+	if title != "Early" {
+		t.Errorf("got %q, want %q", title, "Early")
+	}
+	if reader.n > 64*1024 {
+		t.Errorf("read %d of %d bytes, expected reading to stop after the head", reader.n, len(page))
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -23,7 +24,7 @@ func TestIntegration(t *testing.T) {
 	fetchers := []string{"sql", "colly", "http"}
 	noCache := true
 
-	err = FetchURLTitles(logger, tempFile, "markdown", fetchers, noCache)
+	err = FetchURLTitles(context.Background(), logger, tempFile, "markdown", fetchers, noCache, FetcherOptions{})
 	if err != nil {
 		t.Fatalf("Hello function failed: %v", err)
 	}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// InterstitialError is returned when a URL answers with a bot challenge,
+// cookie-consent wall or login page instead of its content. Such pages come
+// back with a 200 status but their titles describe the interstitial.
+type InterstitialError struct {
+	URL    string
+	Reason string
+}
+
+func (e *InterstitialError) Error() string {
+	return fmt.Sprintf("%s returned an interstitial page: %s", e.URL, e.Reason)
+}
+
+type titlePattern struct {
+	text   string
+	exact  bool
+	prefix bool
+}
+
+// interstitialTitles are lower-cased titles used by challenge, consent and
+// login pages. Exact patterns must match the whole title and prefix patterns
+// its start; the others may appear anywhere in it. Phrases that articles use
+// too, such as "cookie consent", must not be matched anywhere.
+var interstitialTitles = []titlePattern{
+	{text: "just a moment...", exact: true},
+	{text: "just a moment…", exact: true},
+	{text: "please wait...", exact: true},
+	{text: "attention required! | cloudflare", exact: true},
+	{text: "one more step", exact: true},
+	{text: "access denied", exact: true},
+	{text: "robot check", exact: true},
+	{text: "are you a robot?", exact: true},
+	{text: "security check", exact: true},
+	{text: "before you continue", exact: true},
+	{text: "ddos-guard", exact: true},
+	{text: "we value your privacy", exact: true},
+	{text: "cookie consent", exact: true},
+	{text: "before you continue to ", prefix: true},
+	{text: "pardon our interruption"},
+	{text: "verify you are human"},
+	{text: "checking your browser"},
+}
+
+// challengeMarkers are substrings of element ids, classes, script sources and
+// form actions that only appear on bot-challenge pages.
+var challengeMarkers = []string{
+	"cf-browser-verification",
+	"cf-challenge",
+	"challenge-form",
+	"/cdn-cgi/challenge-platform/",
+	"px-captcha",
+	"captcha-delivery.com",
+	"ddos-guard",
+}
+
+var loginHosts = []string{
+	"accounts.google.com",
+	"consent.google.com",
+	"consent.youtube.com",
+	"login.microsoftonline.com",
+	"login.live.com",
+	"signin.aws.amazon.com",
+	"id.atlassian.com",
+}
+
+var loginPathSegments = []string{
+	"login",
+	"log-in",
+	"signin",
+	"sign-in",
+	"sign_in",
+	"sso",
+	"auth",
+	"authenticate",
+	"authorize",
+	"oauth",
+	"session",
+	"sessions",
+}
+
+// detectInterstitial returns an *InterstitialError if the document described
+// by resp and metadata is a challenge, consent or login page rather than the
+// requested content.
+func detectInterstitial(resp responseInfo, metadata PageMetadata) error {
+	if metadata.ChallengeMarker != "" {
+		return &InterstitialError{URL: resp.RequestURL, Reason: "challenge markup " + metadata.ChallengeMarker}
+	}
+
+	for _, title := range []string{metadata.Title, metadata.OGTitle} {
+		if pattern, ok := matchInterstitialTitle(title); ok {
+			return &InterstitialError{URL: resp.RequestURL, Reason: fmt.Sprintf("title %q matches %q", title, pattern)}
+		}
+	}
+
+	if isLoginRedirect(resp.RequestURL, resp.FinalURL) {
+		return &InterstitialError{URL: resp.RequestURL, Reason: "redirected to login page " + resp.FinalURL}
+	}
+
+	return nil
+}
+
+func matchInterstitialTitle(title string) (string, bool) {
+	normalized := strings.ToLower(normalizeText(title))
+	if normalized == "" {
+		return "", false
+	}
+	for _, pattern := range interstitialTitles {
+		var match bool
+		switch {
+		case pattern.exact:
+			match = normalized == pattern.text
+		case pattern.prefix:
+			match = strings.HasPrefix(normalized, pattern.text)
+		default:
+			match = strings.Contains(normalized, pattern.text)
+		}
+		if match {
+			return pattern.text, true
+		}
+	}
+	return "", false
+}
+
+func findChallengeMarker(token html.Token) string {
+	for _, a := range token.Attr {
+		switch a.Key {
+		case "id", "class", "src", "action":
+		default:
+			continue
+		}
+		value := strings.ToLower(a.Val)
+		for _, marker := range challengeMarkers {
+			if strings.Contains(value, marker) {
+				return marker
+			}
+		}
+	}
+	return ""
+}
+
+// isLoginRedirect reports whether a request was redirected to a login or
+// consent page. Links that point at a login page to begin with are left alone.
+func isLoginRedirect(requestURL, finalURL string) bool {
+	if finalURL == "" || finalURL == requestURL {
+		return false
+	}
+	requested, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	final, err := url.Parse(finalURL)
+	if err != nil {
+		return false
+	}
+	return isLoginURL(final) && !isLoginURL(requested)
+}
+
+func isLoginURL(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, loginHost := range loginHosts {
+		if host == loginHost {
+			return true
+		}
+	}
+	for _, segment := range strings.Split(strings.ToLower(u.Path), "/") {
+		for _, loginSegment := range loginPathSegments {
+			if segment == loginSegment {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestExtractTitleDetectsInterstitials(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		resp responseInfo
+	}{
+		{
+			name: "cloudflare challenge title",
+			page: `<html><head><title>Just a moment...</title></head></html>`,
+			resp: responseInfo{RequestURL: "https://example.com/a", FinalURL: "https://example.com/a"},
+		},
+		{
+			name: "challenge platform script",
+			page: `<html><head><title>example.com</title><script src="/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"></script></head></html>`,
+			resp: responseInfo{RequestURL: "https://example.com/a", FinalURL: "https://example.com/a"},
+		},
+		{
+			name: "consent wall",
+			page: `<html><head><title>Before you continue to YouTube</title></head></html>`,
+			resp: responseInfo{RequestURL: "https://www.youtube.com/watch?v=1", FinalURL: "https://consent.youtube.com/m?continue=x"},
+		},
+		{
+			name: "redirect to login",
+			page: `<html><head><title>Sign in to Example</title></head></html>`,
+			resp: responseInfo{RequestURL: "https://example.com/private/doc", FinalURL: "https://example.com/users/login?next=/private/doc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractTitle(testr.New(t), strings.NewReader(tt.page), tt.resp, nil)
+			var interstitialErr *InterstitialError
+			if !errors.As(err, &interstitialErr) {
+				t.Errorf("expected an InterstitialError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractTitleAllowsLoginPagesLinkedDirectly(t *testing.T) {
+	page := `<html><head><title>Sign in to Example</title></head></html>`
+	resp := responseInfo{RequestURL: "https://example.com/login", FinalURL: "https://example.com/login/"}
+
+	title, err := extractTitle(testr.New(t), strings.NewReader(page), resp, nil)
+	if err != nil {
+		t.Fatalf("extractTitle failed: %v", err)
+	}
+	if title != "Sign in to Example" {
+		t.Errorf("got %q", title)
+	}
+}
+
+func TestExtractTitleAllowsArticlesAboutConsent(t *testing.T) {
+	for _, want := range []string{
+		"How to build a cookie consent banner",
+		"Why \"we value your privacy\" rings hollow",
+		"Read this before you continue to the next chapter",
+	} {
+		page := "<html><head><title>" + want + "</title></head></html>"
+		resp := responseInfo{RequestURL: "https://example.com/a", FinalURL: "https://example.com/a"}
+
+		title, err := extractTitle(testr.New(t), strings.NewReader(page), resp, nil)
+		if err != nil {
+			t.Errorf("extractTitle(%q) failed: %v", want, err)
+			continue
+		}
+		if title != want {
+			t.Errorf("got %q, want %q", title, want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultSlowThreshold is how long a link may take to answer before it is
+// reported as slow.
+const DefaultSlowThreshold = 5 * time.Second
+
+type LinkStatus string
+
+const (
+	LinkOK         LinkStatus = "ok"
+	LinkRedirected LinkStatus = "redirected"
+	LinkSlow       LinkStatus = "slow"
+	LinkBroken     LinkStatus = "broken"
+	// LinkUnchecked is reported for links not probed before the deadline.
+	LinkUnchecked LinkStatus = "unchecked"
+)
+
+// LinkCheckResult is the outcome of probing a single URL.
+type LinkCheckResult struct {
+	URL        string
+	FinalURL   string
+	StatusCode int
+	Status     LinkStatus
+	Duration   time.Duration
+	Err        error
+}
+
+// LinkChecker probes URLs for reachability without extracting titles. It
+// shares the worker pool, retry policies and status handling of the title
+// fetchers.
+type LinkChecker struct {
+	logger        logr.Logger
+	client        *http.Client
+	limits        ConcurrencyLimits
+	retries       RetryPolicies
+	slowThreshold time.Duration
+	canonicalizer *URLCanonicalizer
+}
+
+func NewLinkChecker(logger logr.Logger, options FetcherOptions, slowThreshold time.Duration) *LinkChecker {
+	logger.V(1).Info("Debug: Creating new LinkChecker")
+	if slowThreshold <= 0 {
+		slowThreshold = DefaultSlowThreshold
+	}
+	return &LinkChecker{
+		logger:        logger,
+		client:        &http.Client{},
+		limits:        options.Concurrency,
+		retries:       options.Retries,
+		slowThreshold: slowThreshold,
+		canonicalizer: NewURLCanonicalizer(CanonicalizeOptions{}),
+	}
+}
+
+// CheckURLs probes every URL and classifies it as ok, redirected, slow or
+// broken. A link that is both redirected and slow is reported as slow. A
+// redirect to another way of writing the same URL, such as adding a trailing
+// slash, does not count. Links
+// not probed by the time ctx is done are reported as unchecked.
+func (c *LinkChecker) CheckURLs(ctx context.Context, urls []urlRecord) []LinkCheckResult {
+	c.logger.V(1).Info("Debug: Checking links", "urlCount", len(urls))
+
+	probes := fetchTitlesConcurrently(ctx, c.logger, "check", urls, c.limits, c.retries, c.probe)
+
+	var results []LinkCheckResult
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		if seen[u.URL] {
+			continue
+		}
+		seen[u.URL] = true
+
+		probe, ok := probes[u.URL]
+		if !ok || (probe.Err != nil && !isCacheableFailure(probe.Err)) {
+			// Never started, or cut short, because ctx was done.
+			results = append(results, LinkCheckResult{URL: u.URL, Status: LinkUnchecked})
+			continue
+		}
+		result := LinkCheckResult{
+			URL:        u.URL,
+			FinalURL:   probe.FinalURL,
+			StatusCode: probe.StatusCode,
+			Duration:   probe.Duration,
+			Err:        probe.Err,
+		}
+		switch {
+		case probe.Err != nil:
+			result.Status = LinkBroken
+		case probe.Duration > c.slowThreshold:
+			result.Status = LinkSlow
+		case probe.FinalURL != "" && c.canonicalizer.Canonicalize(probe.FinalURL) != c.canonicalizer.Canonicalize(u.URL):
+			result.Status = LinkRedirected
+		default:
+			result.Status = LinkOK
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// probe requests url with HEAD and falls back to GET when that fails, since
+// plenty of servers reject or mishandle HEAD requests. The result's Duration
+// covers this attempt only, not earlier ones that were retried.
+func (c *LinkChecker) probe(ctx context.Context, url string) (TitleResult, error) {
+	start := time.Now()
+	result, err := c.request(ctx, http.MethodHead, url)
+	if err != nil && ctx.Err() == nil {
+		c.logger.V(2).Info("Debug: HEAD request failed, retrying with GET", "url", url, "error", err.Error())
+		result, err = c.request(ctx, http.MethodGet, url)
+	}
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+func (c *LinkChecker) request(ctx context.Context, method, url string) (TitleResult, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return TitleResult{}, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return TitleResult{}, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	// The body is never needed; closing it without reading aborts a GET
+	// once the headers are in.
+	resp.Body.Close()
+
+	c.logger.V(2).Info("Debug: Probed link", "url", url, "method", method, "status", resp.Status)
+	result := TitleResult{
+		FinalURL:    resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	return result, checkHTTPStatus(url, resp.StatusCode, resp.Header)
+}
+
+// CheckLinks extracts URLs from reader, probes them and writes a report in
+// outputFormat ("json", or anything else for plain text) to stdout. It
+// returns the number of broken links. If ctx's deadline passes first, the
+// links checked so far are reported and an error is returned.
+func CheckLinks(
+	ctx context.Context,
+	logger logr.Logger,
+	reader io.Reader,
+	outputFormat string,
+	slowThreshold time.Duration,
+	options FetcherOptions,
+) (int, error) {
+	extractor, err := NewURLExtractor(logger, reader, nil, true, CacheOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create URLExtractor: %w", err)
+	}
+	urls, err := extractor.ExtractURLs()
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract URLs: %w", err)
+	}
+
+	checker := NewLinkChecker(logger, options, slowThreshold)
+	results := checker.CheckURLs(ctx, urls)
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, fmt.Errorf("link check interrupted: %w", err)
+	}
+
+	broken, unchecked := 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case LinkBroken:
+			broken++
+		case LinkUnchecked:
+			unchecked++
+		}
+	}
+
+	var output string
+	if outputFormat == "json" {
+		output, err = GenerateLinkReportJSON(results)
+		if err != nil {
+			return broken, fmt.Errorf("failed to generate JSON: %w", err)
+		}
+	} else {
+		output = GenerateLinkReport(results)
+	}
+	if _, err := io.WriteString(os.Stdout, output); err != nil {
+		return broken, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	if unchecked > 0 {
+		return broken, fmt.Errorf("deadline reached with %d links unchecked: %w", unchecked, ctx.Err())
+	}
+	return broken, nil
+}
+
+// GenerateLinkReport lists every link that is not ok, followed by a summary
+// line.
+func GenerateLinkReport(results []LinkCheckResult) string {
+	var sb strings.Builder
+	counts := make(map[LinkStatus]int)
+	for _, result := range results {
+		counts[result.Status]++
+		switch result.Status {
+		case LinkBroken:
+			sb.WriteString(fmt.Sprintf("BROKEN     %s: %v\n", result.URL, result.Err))
+		case LinkRedirected:
+			sb.WriteString(fmt.Sprintf("REDIRECTED %s -> %s\n", result.URL, result.FinalURL))
+		case LinkSlow:
+			sb.WriteString(fmt.Sprintf("SLOW       %s (%s)\n", result.URL, result.Duration.Round(time.Millisecond)))
+		case LinkUnchecked:
+			sb.WriteString(fmt.Sprintf("UNCHECKED  %s\n", result.URL))
+		}
+	}
+	checked := len(results) - counts[LinkUnchecked]
+	sb.WriteString(fmt.Sprintf("%d links checked: %d ok, %d redirected, %d slow, %d broken",
+		checked, counts[LinkOK], counts[LinkRedirected], counts[LinkSlow], counts[LinkBroken]))
+	if counts[LinkUnchecked] > 0 {
+		sb.WriteString(fmt.Sprintf("; %d unchecked", counts[LinkUnchecked]))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+type jsonLinkCheckResult struct {
+	URL        string     `json:"url"`
+	Status     LinkStatus `json:"status"`
+	FinalURL   string     `json:"finalUrl,omitempty"`
+	StatusCode int        `json:"httpStatus,omitempty"`
+	DurationMS float64    `json:"durationMs"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func GenerateLinkReportJSON(results []LinkCheckResult) (string, error) {
+	entries := make([]jsonLinkCheckResult, 0, len(results))
+	for _, result := range results {
+		entry := jsonLinkCheckResult{
+			URL:        result.URL,
+			Status:     result.Status,
+			FinalURL:   result.FinalURL,
+			StatusCode: result.StatusCode,
+			DurationMS: float64(result.Duration.Microseconds()) / 1000,
+		}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestLinkCheckerClassifiesLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/old":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	urls := []urlRecord{
+		newURLRecord(server.URL + "/ok"),
+		newURLRecord(server.URL + "/no-head"),
+		newURLRecord(server.URL + "/old"),
+		newURLRecord(server.URL + "/slow"),
+		newURLRecord(server.URL + "/gone"),
+		newURLRecord(server.URL + "/ok"),
+	}
+
+	checker := NewLinkChecker(testr.New(t), FetcherOptions{Retries: RetryPolicies{Default: RetryPolicy{MaxAttempts: 1}}}, 25*time.Millisecond)
+	results := checker.CheckURLs(context.Background(), urls)
+
+	want := map[string]LinkStatus{
+		"/ok":      LinkOK,
+		"/no-head": LinkOK,
+		"/old":     LinkRedirected,
+		"/slow":    LinkSlow,
+		"/gone":    LinkBroken,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		path := result.URL[len(server.URL):]
+		if result.Status != want[path] {
+			t.Errorf("%s: status = %s, want %s (err %v)", path, result.Status, want[path], result.Err)
+		}
+	}
+
+	if results[4].StatusCode != http.StatusNotFound {
+		t.Errorf("/gone: HTTP status = %d, want 404", results[4].StatusCode)
+	}
+	if results[2].FinalURL != server.URL+"/ok" {
+		t.Errorf("/old: final URL = %q", results[2].FinalURL)
+	}
+}
+
+func TestLinkCheckerReportsUncheckedLinksAtDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	// The hanging links share a host, so one of them waits for the other.
+	otherHost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	urls := []urlRecord{
+		newURLRecord(otherHost + "/ok"),
+		newURLRecord(server.URL + "/hang"),
+		newURLRecord(server.URL + "/queued"),
+	}
+	options := FetcherOptions{
+		Concurrency: ConcurrencyLimits{Global: 2, PerHost: 1},
+		Retries:     RetryPolicies{Default: RetryPolicy{MaxAttempts: 1}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	results := NewLinkChecker(testr.New(t), options, 0).CheckURLs(ctx, urls)
+	want := []LinkStatus{LinkOK, LinkUnchecked, LinkUnchecked}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Status != want[i] {
+			t.Errorf("%s: status = %s, want %s", result.URL, result.Status, want[i])
+		}
+	}
+	if report := GenerateLinkReport(results); !strings.Contains(report, "1 links checked: 1 ok, 0 redirected, 0 slow, 0 broken; 2 unchecked") {
+		t.Errorf("report = %q", report)
+	}
+}
+
+func TestLinkCheckerIgnoresRetriesAndEquivalentRedirects(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			// The first attempt's HEAD and GET fail.
+			if requests.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/docs":
+			http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	urls := []urlRecord{
+		newURLRecord(server.URL + "/flaky"),
+		newURLRecord(server.URL + "/docs"),
+	}
+	options := FetcherOptions{Retries: RetryPolicies{Default: RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+	}}}
+	results := NewLinkChecker(testr.New(t), options, 50*time.Millisecond).CheckURLs(context.Background(), urls)
+
+	for _, result := range results {
+		if result.Status != LinkOK {
+			t.Errorf("%s: status = %s, want %s (took %s, final URL %s)", result.URL, result.Status, LinkOK, result.Duration, result.FinalURL)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// nonHTMLResponse describes a response that is not an HTML document.
+type nonHTMLResponse struct {
+	URL                string
+	FinalURL           string
+	ContentType        string
+	ContentDisposition string
+	// ContentLength is the body size in bytes, or -1 if unknown.
+	ContentLength int64
+}
+
+func newNonHTMLResponse(url, finalURL string, header http.Header) nonHTMLResponse {
+	contentLength, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		contentLength = -1
+	}
+	return nonHTMLResponse{
+		URL:                url,
+		FinalURL:           finalURL,
+		ContentType:        header.Get("Content-Type"),
+		ContentDisposition: header.Get("Content-Disposition"),
+		ContentLength:      contentLength,
+	}
+}
+
+// needsBody reports whether resolveNonHTMLTitle can make use of the body.
+func (r nonHTMLResponse) needsBody() bool {
+	return mediaTypeOf(r.ContentType) == "application/pdf"
+}
+
+// resolveNonHTMLTitle returns a title for a PDF, image, media file or other
+// download. PDFs use their embedded document title when body is given and
+// has one; everything else is labelled with its file name, type and size,
+// e.g. "report.pdf (PDF, 2.3 MB)".
+func resolveNonHTMLTitle(logger logr.Logger, resp nonHTMLResponse, body io.Reader) (string, error) {
+	if body != nil && resp.needsBody() {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read PDF: %w", err)
+		}
+		if title := pdfTitle(data); title != "" {
+			logger.V(2).Info("Debug: Found PDF document title", "url", resp.URL, "title", title)
+			return title, nil
+		}
+		logger.V(2).Info("Debug: PDF has no readable title, using file name", "url", resp.URL)
+	}
+
+	name := downloadFileName(resp)
+	label := contentTypeLabel(resp.ContentType)
+
+	details := []string{label}
+	if resp.ContentLength > 0 {
+		details = append(details, formatByteSize(resp.ContentLength))
+	}
+	title := fmt.Sprintf("%s (%s)", name, strings.Join(details, ", "))
+	logger.V(2).Info("Debug: Labelled non-HTML response", "url", resp.URL, "title", title)
+	return title, nil
+}
+
+// downloadFileName returns the file name from Content-Disposition, or else the
+// last segment of the final URL's path, or else its host.
+func downloadFileName(resp nonHTMLResponse) string {
+	if resp.ContentDisposition != "" {
+		if _, params, err := mime.ParseMediaType(resp.ContentDisposition); err == nil {
+			if name := path.Base(strings.ReplaceAll(params["filename"], `\`, "/")); name != "." && name != "/" && name != "" {
+				return name
+			}
+		}
+	}
+
+	rawURL := resp.FinalURL
+	if rawURL == "" {
+		rawURL = resp.URL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if name := path.Base(parsed.Path); name != "." && name != "/" {
+		return name
+	}
+	return parsed.Host
+}
+
+var contentTypeLabels = map[string]string{
+	"application/pdf":             "PDF",
+	"application/zip":             "ZIP",
+	"application/gzip":            "GZIP",
+	"application/x-gzip":          "GZIP",
+	"application/x-tar":           "TAR",
+	"application/x-iso9660-image": "ISO image",
+	"application/json":            "JSON",
+	"application/msword":          "Word document",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "Word document",
+	"application/vnd.ms-excel": "Excel spreadsheet",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         "Excel spreadsheet",
+	"application/vnd.ms-powerpoint":                                             "PowerPoint presentation",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": "PowerPoint presentation",
+	"application/octet-stream":                                                  "download",
+	"audio/mpeg":                                                                "MP3 audio",
+	"image/svg+xml":                                                             "SVG image",
+	"text/plain":                                                                "text",
+}
+
+func contentTypeLabel(contentType string) string {
+	mediaType := mediaTypeOf(contentType)
+	if label, ok := contentTypeLabels[mediaType]; ok {
+		return label
+	}
+
+	kind, subtype, found := strings.Cut(mediaType, "/")
+	if !found {
+		return "file"
+	}
+	subtype = strings.TrimPrefix(subtype, "x-")
+	subtype, _, _ = strings.Cut(subtype, "+")
+	subtype = strings.ToUpper(subtype)
+	switch kind {
+	case "image", "audio", "video":
+		return subtype + " " + kind
+	}
+	return subtype
+}
+
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
+
+func formatByteSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	for _, suffix := range []string{"kB", "MB", "GB", "TB"} {
+		value /= unit
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+	}
+	return fmt.Sprintf("%.1f PB", value/unit)
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+const testPDF = `%PDF-1.4
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R /Outlines 4 0 R >>
+endobj
+4 0 obj
+<< /Title (Chapter One) >>
+endobj
+7 0 obj
+<< /Title (Quarterly Report \(Q3\) \351t\351) /Author (Someone) >>
+endobj
+trailer
+<< /Root 1 0 R /Info 7 0 R >>
+%%EOF`
+
+func TestPDFTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"info dictionary literal", testPDF, "Quarterly Report (Q3) été"},
+		{"info dictionary utf-16", "3 0 obj\n<< /Title <FEFF00480069> >>\nendobj\ntrailer << /Info 3 0 R >>", "Hi"},
+		{"xmp metadata", `<x:xmpmeta><dc:title><rdf:Alt><rdf:li xml:lang="x-default">XMP &amp; Title</rdf:li></rdf:Alt></dc:title></x:xmpmeta>`, "XMP & Title"},
+		{"no metadata", "%PDF-1.7\n1 0 obj << /Title (Outline only) >> endobj", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfTitle([]byte(tt.data)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFTitleInObjectStream(t *testing.T) {
+	var objects bytes.Buffer
+	header := "5 0 6 32 "
+	objects.WriteString(header + strings.Repeat(" ", 32-len(header)))
+	objects.WriteString("<< /Title (Chapter) >>")
+	for objects.Len() < 64 {
+		objects.WriteByte(' ')
+	}
+	objects.WriteString("<< /Title (Compressed Title) /Producer (Test) >>")
+
+	var stream bytes.Buffer
+	w := zlib.NewWriter(&stream)
+	w.Write(objects.Bytes())
+	w.Close()
+
+	data := fmt.Sprintf("%%PDF-1.5\n9 0 obj\n<< /Type /ObjStm /N 2 /First 32 /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n"+
+		"10 0 obj\n<< /Type /XRef /Root 1 0 R /Info 6 0 R >>\nstream\nendstream\nendobj\n", stream.Len(), stream.Bytes())
+	if got := pdfTitle([]byte(data)); got != "Compressed Title" {
+		t.Errorf("got %q, want %q", got, "Compressed Title")
+	}
+}
+
+func TestHTTPTitleFetcherReadsEndOfLargePDF(t *testing.T) {
+	pdf := "%PDF-1.4\n" + strings.Repeat("% padding\n", 1000) + strings.TrimPrefix(testPDF, "%PDF-1.4\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		http.ServeContent(w, r, "report.pdf", time.Time{}, strings.NewReader(pdf))
+	}))
+	defer server.Close()
+
+	fetcher := NewHTTPTitleFetcher(testr.New(t), FetcherOptions{MaxBodyBytes: 1024})
+	results, err := fetcher.FetchTitles(context.Background(), []urlRecord{newURLRecord(server.URL + "/report.pdf")})
+	if err != nil {
+		t.Fatalf("FetchTitles failed: %v", err)
+	}
+	if got := results[server.URL+"/report.pdf"].Title; got != "Quarterly Report (Q3) été" {
+		t.Errorf("title = %q", got)
+	}
+}
+
+func TestHTTPTitleFetcherNonHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			io.WriteString(w, testPDF)
+		case "/docs/untitled.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Length", "2300000")
+			w.Write([]byte(strings.Repeat(" ", 2300000)))
+		case "/download":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="setup 1.2.exe"`)
+		case "/media/My Song.mp3":
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Header().Set("Content-Length", "4500000")
+		case "/img/cat.png":
+			w.Header().Set("Content-Type", "image/png")
+		}
+	}))
+	defer server.Close()
+
+	want := map[string]string{
+		"/docs/report.pdf":     "Quarterly Report (Q3) été",
+		"/docs/untitled.pdf":   "untitled.pdf (PDF, 2.3 MB)",
+		"/download":            "setup 1.2.exe (download)",
+		"/media/My%20Song.mp3": "My Song.mp3 (MP3 audio, 4.5 MB)",
+		"/img/cat.png":         "cat.png (PNG image)",
+	}
+
+	var urls []urlRecord
+	for path := range want {
+		urls = append(urls, newURLRecord(server.URL+path))
+	}
+
+	fetcher := NewHTTPTitleFetcher(testr.New(t), FetcherOptions{MaxBodyBytes: 4 << 20})
+	results, err := fetcher.FetchTitles(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("FetchTitles failed: %v", err)
+	}
+	for path, title := range want {
+		got := results[server.URL+path]
+		if got.Err != nil || got.Title != title {
+			t.Errorf("%s: got %+v, want title %q", path, got, title)
+		}
+	}
+}
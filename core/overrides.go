@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"gopkg.in/yaml.v3"
+)
+
+const overridesFileName = "hollowbeak/overrides.yaml"
+
+// GetOverridesPath returns the default location of the title overrides file.
+func GetOverridesPath() (string, error) {
+	path, err := xdg.ConfigFile(overridesFileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get XDG config file path: %w", err)
+	}
+	return filepath.Abs(path)
+}
+
+// LoadTitleOverrides reads a YAML file mapping URLs to the titles to use for
+// them, e.g.
+//
+//	https://example.com/: Example home page
+//
+// A missing file yields no overrides.
+func LoadTitleOverrides(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read overrides file: %w", err)
+	}
+
+	overrides := make(map[string]string)
+	if err := yaml.Unmarshal(raw, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides file %s: %w", path, err)
+	}
+	return overrides, nil
+}
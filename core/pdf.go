@@ -0,0 +1,245 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"unicode/utf16"
+)
+
+// maxPDFObjectStreamBytes caps how much of a compressed object stream is
+// decompressed.
+const maxPDFObjectStreamBytes = 4 << 20
+
+var (
+	pdfInfoRefPattern = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfObjPattern     = regexp.MustCompile(`(?:^|\s)(\d+)\s+(\d+)\s+obj\b`)
+	pdfStreamPattern  = regexp.MustCompile(`>>\s*stream\r?\n`)
+	pdfIntKey         = regexp.MustCompile(`/(N|First)\s+(\d+)`)
+	pdfTitleKey       = regexp.MustCompile(`/Title\s*([(<])`)
+	xmpTitlePattern   = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+)
+
+// pdfTitle returns the document title of a PDF, taken from its Info
+// dictionary or, failing that, its XMP metadata. The Info dictionary may be
+// stored as a plain object or in a Flate-compressed object stream; XMP
+// metadata is only found if it is not compressed.
+func pdfTitle(data []byte) string {
+	if title := pdfInfoTitle(data); title != "" {
+		return title
+	}
+	if match := xmpTitlePattern.FindSubmatch(data); match != nil {
+		return normalizeText(html.UnescapeString(string(match[1])))
+	}
+	return ""
+}
+
+func pdfInfoTitle(data []byte) string {
+	// Several trailers may reference an Info dictionary when a PDF has been
+	// updated incrementally; the last one is current.
+	refs := pdfInfoRefPattern.FindAllSubmatch(data, -1)
+	if refs == nil {
+		return ""
+	}
+	ref := refs[len(refs)-1]
+
+	obj := pdfObject(data, string(ref[1]), string(ref[2]))
+	if obj == nil {
+		return ""
+	}
+	match := pdfTitleKey.FindSubmatchIndex(obj)
+	if match == nil {
+		return ""
+	}
+	var raw []byte
+	if obj[match[2]] == '(' {
+		raw = parsePDFLiteralString(obj[match[3]:])
+	} else {
+		raw = parsePDFHexString(obj[match[3]:])
+	}
+	return normalizeText(decodePDFText(raw))
+}
+
+// pdfObject returns the body of object num gen, looking for it first as a
+// plain object and then in the object streams.
+func pdfObject(data []byte, num, gen string) []byte {
+	// The last definition of an object wins, as with the trailers.
+	var obj []byte
+	for _, loc := range pdfObjPattern.FindAllSubmatchIndex(data, -1) {
+		if string(data[loc[2]:loc[3]]) == num && string(data[loc[4]:loc[5]]) == gen {
+			obj = data[loc[1]:]
+		}
+	}
+	if obj != nil {
+		if end := bytes.Index(obj, []byte("endobj")); end >= 0 {
+			obj = obj[:end]
+		}
+		return obj
+	}
+	// Objects in object streams always have generation 0.
+	if gen != "0" {
+		return nil
+	}
+	for _, loc := range pdfStreamPattern.FindAllIndex(data, -1) {
+		// The stream's dictionary starts after its object header.
+		start := bytes.LastIndex(data[:loc[0]], []byte("obj"))
+		if start < 0 {
+			continue
+		}
+		if obj := pdfObjectStreamMember(data[start:loc[0]], data[loc[1]:], num); obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+// pdfObjectStreamMember returns object num from the object stream with the
+// dictionary dict and the data stream, or nil if the stream is not a
+// Flate-compressed object stream holding it.
+func pdfObjectStreamMember(dict, stream []byte, num string) []byte {
+	if !bytes.Contains(dict, []byte("/ObjStm")) || !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Contains(dict, []byte("/DecodeParms")) {
+		return nil
+	}
+	var n, first int
+	for _, match := range pdfIntKey.FindAllSubmatch(dict, -1) {
+		value, _ := strconv.Atoi(string(match[2]))
+		if string(match[1]) == "N" {
+			n = value
+		} else {
+			first = value
+		}
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	// The stream's length is not needed: the compressed data ends itself,
+	// and whatever could be decompressed before an error is still usable.
+	content, _ := io.ReadAll(io.LimitReader(reader, maxPDFObjectStreamBytes))
+	if first <= 0 || first > len(content) {
+		return nil
+	}
+
+	// The stream starts with n pairs of object numbers and offsets relative
+	// to first, in order of offset.
+	header := bytes.Fields(content[:first])
+	for i := 0; i+1 < len(header) && i < 2*n; i += 2 {
+		if string(header[i]) != num {
+			continue
+		}
+		start, err := strconv.Atoi(string(header[i+1]))
+		if err != nil || first+start > len(content) {
+			return nil
+		}
+		end := len(content)
+		if i+3 < len(header) && i+2 < 2*n {
+			if next, err := strconv.Atoi(string(header[i+3])); err == nil && next >= start && first+next <= len(content) {
+				end = first + next
+			}
+		}
+		return content[first+start : end]
+	}
+	return nil
+}
+
+// parsePDFLiteralString parses a (...) string whose opening parenthesis has
+// already been consumed.
+func parsePDFLiteralString(data []byte) []byte {
+	var out []byte
+	depth := 1
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			i++
+			if i >= len(data) {
+				return out
+			}
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string.
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(data[i:j]), 8, 8)
+					out = append(out, byte(n))
+					i = j - 1
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// parsePDFHexString parses a <...> string whose opening bracket has already
+// been consumed.
+func parsePDFHexString(data []byte) []byte {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+// decodePDFText decodes a PDF text string, which is UTF-16BE when it starts
+// with a byte order mark and PDFDocEncoding otherwise. PDFDocEncoding is
+// treated as Latin-1, which it matches for all printable characters in use.
+func decodePDFText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(raw) >= 3 && raw[0] == 0xef && raw[1] == 0xbb && raw[2] == 0xbf {
+		return string(raw[3:])
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
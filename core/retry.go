@@ -0,0 +1,204 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryInitialBackoff = 500 * time.Millisecond
+	DefaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// RetryPolicy controls how often and how patiently a failed fetch is retried.
+// Only transient failures are retried; every fetch hollowbeak makes is a GET
+// and therefore safe to repeat.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `mapstructure:"max-attempts"`
+	// InitialBackoff is the delay before the first retry. Each further retry
+	// doubles it, with jitter, up to MaxBackoff.
+	InitialBackoff time.Duration `mapstructure:"initial-backoff"`
+	// MaxBackoff caps the delay between attempts. A Retry-After longer than
+	// this is not waited for and the failure is returned instead.
+	MaxBackoff time.Duration `mapstructure:"max-backoff"`
+}
+
+// RetryPolicies holds the default policy and per-domain overrides. A domain
+// override also applies to its subdomains.
+type RetryPolicies struct {
+	Default   RetryPolicy
+	PerDomain map[string]RetryPolicy
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultRetryMaxAttempts,
+		InitialBackoff: DefaultRetryInitialBackoff,
+		MaxBackoff:     DefaultRetryMaxBackoff,
+	}
+}
+
+// For returns the policy for host, preferring the most specific domain
+// override. Unset fields of an override fall back to the default policy.
+func (p RetryPolicies) For(host string) RetryPolicy {
+	policy := p.Default
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for domain := host; domain != ""; {
+		if override, ok := p.PerDomain[domain]; ok {
+			if override.MaxAttempts > 0 {
+				policy.MaxAttempts = override.MaxAttempts
+			}
+			if override.InitialBackoff > 0 {
+				policy.InitialBackoff = override.InitialBackoff
+			}
+			if override.MaxBackoff > 0 {
+				policy.MaxBackoff = override.MaxBackoff
+			}
+			break
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+
+	return policy
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Equal jitter keeps at least half the delay while spreading out retries
+	// that failed at the same moment.
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// fetchWithRetries calls fetch until it succeeds, fails permanently or the
+// policy's attempts are used up.
+func fetchWithRetries(
+	ctx context.Context,
+	logger logr.Logger,
+	policy RetryPolicy,
+	url string,
+	fetch func(ctx context.Context, url string) (TitleResult, error),
+) (TitleResult, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fetch(ctx, url)
+		if err == nil {
+			if attempt > 1 {
+				logger.V(1).Info("Debug: Fetch succeeded after retries", "url", url, "attempts", attempt)
+			}
+			return result, nil
+		}
+
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil || !isTransient(err) {
+			if attempt > 1 {
+				logger.V(1).Info("Debug: Giving up after retries", "url", url, "attempts", attempt, "error", err.Error())
+			}
+			return result, err
+		}
+
+		delay := policy.backoff(attempt)
+		if retryAfter := retryAfterOf(err); retryAfter > 0 {
+			if retryAfter > policy.MaxBackoff {
+				logger.V(1).Info("Debug: Retry-After exceeds maximum backoff, not retrying", "url", url, "retryAfter", retryAfter)
+				return result, err
+			}
+			delay = retryAfter
+		}
+
+		logger.V(1).Info("Debug: Retrying fetch", "url", url, "attempt", attempt, "maxAttempts", policy.MaxAttempts, "delay", delay, "error", err.Error())
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		}
+	}
+}
+
+// isTransient reports whether err is a failure that may succeed if the same
+// request is repeated.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout,
+			http.StatusTooEarly,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryAfterOf(err error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestHTTPTitleFetcherRetriesTransientFailures(t *testing.T) {
+	var unavailable, missing, untitled atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if unavailable.Add(1) < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "<title>Recovered</title>")
+		case "/missing":
+			missing.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		case "/untitled":
+			untitled.Add(1)
+			fmt.Fprint(w, "<html><head></head><body></body></html>")
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewHTTPTitleFetcher(testr.New(t), FetcherOptions{
+		Retries: RetryPolicies{Default: RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+		}},
+	})
+	results, err := fetcher.FetchTitles(context.Background(), []urlRecord{
+		newURLRecord(server.URL + "/flaky"),
+		newURLRecord(server.URL + "/missing"),
+		newURLRecord(server.URL + "/untitled"),
+	})
+	if err != nil {
+		t.Fatalf("FetchTitles failed: %v", err)
+	}
+
+	if got := results[server.URL+"/flaky"].Title; got != "Recovered" {
+		t.Errorf("flaky title = %q, want %q", got, "Recovered")
+	}
+	if n := unavailable.Load(); n != 3 {
+		t.Errorf("flaky URL requested %d times, want 3", n)
+	}
+	if n := missing.Load(); n != 1 {
+		t.Errorf("404 URL requested %d times, want 1", n)
+	}
+	if n := untitled.Load(); n != 1 {
+		t.Errorf("untitled URL requested %d times, want 1", n)
+	}
+}
+
+func TestRetryPoliciesFor(t *testing.T) {
+	policies := RetryPolicies{
+		Default: DefaultRetryPolicy(),
+		PerDomain: map[string]RetryPolicy{
+			"github.com": {MaxAttempts: 5},
+		},
+	}
+
+	if got := policies.For("api.github.com:443"); got.MaxAttempts != 5 || got.MaxBackoff != DefaultRetryMaxBackoff {
+		t.Errorf("subdomain policy = %+v", got)
+	}
+	if got := policies.For("notgithub.com"); got.MaxAttempts != DefaultRetryMaxAttempts {
+		t.Errorf("unrelated domain policy = %+v", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
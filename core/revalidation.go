@@ -0,0 +1,63 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMinCacheTTL is the shortest time a title is cached for when the TTL
+// follows the server's Cache-Control or Expires headers.
+const DefaultMinCacheTTL = 24 * time.Hour
+
+// staleCacheRetention is how long an expired title that can be revalidated
+// with a conditional request is kept before it is discarded.
+const staleCacheRetention = DefaultCacheTTL
+
+// setConditionalHeaders asks the server to answer 304 Not Modified if the page
+// still matches the cached copy that url's validators describe.
+func setConditionalHeaders(header http.Header, url urlRecord) {
+	if url.ETag != "" {
+		header.Set("If-None-Match", url.ETag)
+	}
+	if url.LastModified != "" {
+		header.Set("If-Modified-Since", url.LastModified)
+	}
+}
+
+// recordCacheHeaders copies the validators and freshness lifetime of a
+// response into result.
+func recordCacheHeaders(result *TitleResult, header http.Header, now time.Time) {
+	result.ETag = header.Get("ETag")
+	result.LastModified = header.Get("Last-Modified")
+	result.FreshUntil = freshUntil(header, now)
+}
+
+// freshUntil returns when a response received at now goes stale according to
+// its Cache-Control max-age or, failing that, its Expires header. It returns
+// the zero time if the response carries neither.
+func freshUntil(header http.Header, now time.Time) time.Time {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return now
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err == nil && seconds >= 0 {
+				return now.Add(time.Duration(seconds) * time.Second)
+			}
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires, such as "0", means already expired.
+			return now
+		}
+		return t
+	}
+	return time.Time{}
+}
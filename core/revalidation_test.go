@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestFreshUntil(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Time
+	}{
+		{"none", http.Header{}, time.Time{}},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=3600"}}, now.Add(time.Hour)},
+		{"max-age over expires", http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Wed, 01 Jan 2025 00:00:00 GMT"}}, now.Add(time.Minute)},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache"}}, now},
+		{"expires", http.Header{"Expires": {"Wed, 01 Jan 2025 00:00:00 GMT"}}, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"invalid expires", http.Header{"Expires": {"0"}}, now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := freshUntil(tt.header, now); !got.Equal(tt.want) {
+				t.Errorf("freshUntil = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOrFetchTitlesRevalidatesExpiredTitles(t *testing.T) {
+	var conditional string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = r.Header.Get("If-None-Match")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=604800")
+		if conditional == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Fresh</title></head></html>"))
+	}))
+	defer server.Close()
+
+	useTempXDGState(t)
+	logger := testr.New(t)
+	options := CacheOptions{File: filepath.Join(t.TempDir(), "titles.json"), ServerTTL: true}
+	cache, err := NewCache(logger, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := NewURLCanonicalizer(options.Canonicalize).Canonicalize(server.URL)
+	cache.put(key, CacheItem{
+		Value:     "Cached",
+		ETag:      `"v1"`,
+		FetchedAt: time.Now().Add(-48 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	})
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := NewHTTPTitleFetcher(logger, FetcherOptions{})
+	extractor, err := NewURLExtractor(logger, strings.NewReader(""), []TitleFetcher{fetcher}, false, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles, err := extractor.GetOrFetchTitles(context.Background(), []urlRecord{newURLRecord(server.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conditional != `"v1"` {
+		t.Errorf("If-None-Match = %q, want the cached ETag", conditional)
+	}
+	if got := titles[server.URL]; got.Title != "Cached" || got.StatusCode != http.StatusNotModified || got.Fetcher != "http" {
+		t.Errorf("result = %+v, want the revalidated cached title", got)
+	}
+	item, ok := extractor.cache.Lookup(key)
+	if !ok || item.ExpiresAt.Before(time.Now().Add(6*24*time.Hour)) {
+		t.Errorf("revalidated entry = %+v, %v; want it to follow max-age", item, ok)
+	}
+}
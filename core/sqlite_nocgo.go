@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package core
+
+// sqliteAvailable reports whether the SQLite driver was built; go-sqlite3
+// needs cgo.
+const sqliteAvailable = false
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -11,72 +13,116 @@ import (
 )
 
 type CollyTitleFetcher struct {
-	logger logr.Logger
+	logger       logr.Logger
+	limits       ConcurrencyLimits
+	retries      RetryPolicies
+	maxBodyBytes int64
+	titleSources []string
 }
 
-func NewCollyTitleFetcher(logger logr.Logger) *CollyTitleFetcher {
+func NewCollyTitleFetcher(logger logr.Logger, options FetcherOptions) *CollyTitleFetcher {
 	logger.V(1).Info("Debug: Creating new CollyTitleFetcher")
 	return &CollyTitleFetcher{
-		logger: logger,
+		logger:       logger,
+		limits:       options.Concurrency,
+		retries:      options.Retries,
+		maxBodyBytes: maxBodyBytesOrDefault(options.MaxBodyBytes),
+		titleSources: options.TitleSources,
 	}
 }
 
-func (f *CollyTitleFetcher) FetchTitles(urls []urlRecord) (map[string]string, error) {
+func (f *CollyTitleFetcher) FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
 	f.logger.V(1).Info("Debug: Fetching titles with Colly", "urlCount", len(urls))
 
-	titles := make(map[string]string)
-	for _, url := range urls {
-		title, err := f.fetchTitle(url.URL)
-		if err != nil {
-			f.logger.Error(err, "Failed to fetch title with Colly", "url", url.URL)
-			titles[url.URL] = ""
-		} else {
-			titles[url.URL] = title
-		}
-	}
+	records := recordsByURL(urls)
+	titles := fetchTitlesConcurrently(ctx, f.logger, "colly", urls, f.limits, f.retries, func(ctx context.Context, url string) (TitleResult, error) {
+		return f.fetchTitle(ctx, records[url])
+	})
 
 	return titles, nil
 }
 
-func (f *CollyTitleFetcher) fetchTitle(url string) (string, error) {
+func (f *CollyTitleFetcher) fetchTitle(ctx context.Context, record urlRecord) (TitleResult, error) {
+	url := record.URL
 	f.logger.V(2).Info("Debug: Creating Colly collector", "url", url)
 	c := colly.NewCollector(
 		colly.AllowURLRevisit(),
 		colly.MaxDepth(5),
+		colly.MaxBodySize(int(f.maxBodyBytes)),
 	)
 
 	// Increase timeouts
 	c.SetRequestTimeout(30 * time.Second)
 
 	// Configure transport
-	c.WithTransport(&http.Transport{
-		TLSHandshakeTimeout:   15 * time.Second,
-		ResponseHeaderTimeout: 15 * time.Second,
-		ExpectContinueTimeout: 5 * time.Second,
+	c.WithTransport(&contextTransport{
+		ctx: ctx,
+		base: &http.Transport{
+			TLSHandshakeTimeout:   15 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			ExpectContinueTimeout: 5 * time.Second,
+		},
 	})
 
 	c.UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
 	f.logger.V(2).Info("Debug: Set User-Agent for Colly collector", "userAgent", c.UserAgent)
 
-	var title string
+	var title, description string
 	var finalURL string
+	var statusCode int
+	var statusHeader http.Header
+	var extractErr error
+	var nonHTML *nonHTMLResponse
 
 	c.OnHTML("html", func(e *colly.HTMLElement) {
-		titleElement := e.DOM.Find("title")
-		if titleElement.Length() == 0 {
-			f.logger.V(2).Info("Debug: No title element found in HTML")
+		// Colly has already transcoded the body to UTF-8 when the response
+		// declared a charset; otherwise the body is still in its original
+		// encoding and has to be detected from the document itself.
+		contentType := e.Response.Headers.Get("Content-Type")
+		if strings.Contains(strings.ToLower(contentType), "charset") {
+			contentType = "text/html; charset=utf-8"
+		}
+
+		summary, err := summarizePage(f.logger, bytes.NewReader(e.Response.Body), responseInfo{
+			RequestURL:  url,
+			FinalURL:    e.Request.URL.String(),
+			ContentType: contentType,
+		}, f.titleSources)
+		if err != nil {
+			extractErr = err
+			f.logger.V(2).Info("Debug: No title found in HTML", "error", err.Error())
 		} else {
-			title = strings.TrimSpace(titleElement.Text())
-			finalURL = e.Request.URL.String()
-			f.logger.V(2).Info("Debug: Found title", "title", title, "url", finalURL)
+			title, description = summary.Title, summary.Description
+			f.logger.V(2).Info("Debug: Found title", "title", title, "url", e.Request.URL.String())
 		}
 	})
 
 	c.OnRequest(func(r *colly.Request) {
 		f.logger.V(3).Info("Debug: Colly making request", "url", r.URL.String())
+		setConditionalHeaders(*r.Headers, record)
+	})
+
+	c.OnResponseHeaders(func(r *colly.Response) {
+		statusCode = r.StatusCode
+		statusHeader = *r.Headers
+		finalURL = r.Request.URL.String()
+		contentType := r.Headers.Get("Content-Type")
+		if isSuccessStatus(r.StatusCode) && !isHTMLContentType(contentType) {
+			f.logger.V(1).Info("Debug: Resolving title of non-HTML response", "url", url, "contentType", contentType)
+			resp := newNonHTMLResponse(url, r.Request.URL.String(), *r.Headers)
+			nonHTML = &resp
+			if !resp.needsBody() {
+				title, extractErr = resolveNonHTMLTitle(f.logger, resp, nil)
+				r.Request.Abort()
+			}
+		}
 	})
 
 	c.OnResponse(func(r *colly.Response) {
+		statusCode = r.StatusCode
+		if nonHTML != nil && nonHTML.needsBody() {
+			title, extractErr = resolveNonHTMLTitle(f.logger, *nonHTML, bytes.NewReader(r.Body))
+		}
 		f.logger.V(3).Info("Debug: Colly received response", "url", r.Request.URL.String(), "statusCode", r.StatusCode)
 		if r.Request.URL.String() != url {
 			f.logger.V(2).Info("Debug: Followed redirect", "from", url, "to", r.Request.URL.String())
@@ -84,21 +130,63 @@ func (f *CollyTitleFetcher) fetchTitle(url string) (string, error) {
 	})
 
 	c.OnError(func(r *colly.Response, err error) {
-		f.logger.Error(err, "Colly encountered an error", "url", r.Request.URL.String(), "statusCode", r.StatusCode)
+		statusCode = r.StatusCode
+		if r.Headers != nil {
+			statusHeader = *r.Headers
+		}
+		if r.Request != nil {
+			finalURL = r.Request.URL.String()
+		}
+		f.logger.V(1).Info("Debug: Colly encountered an error", "url", r.Request.URL.String(), "statusCode", r.StatusCode, "error", err.Error())
 	})
 
 	f.logger.V(2).Info("Debug: Starting Colly visit", "url", url)
 	err := c.Visit(url)
+	result := TitleResult{
+		FinalURL:    finalURL,
+		StatusCode:  statusCode,
+		ContentType: statusHeader.Get("Content-Type"),
+	}
+	recordCacheHeaders(&result, statusHeader, time.Now())
+	if statusCode == http.StatusNotModified {
+		f.logger.V(1).Info("Debug: Cached title is still current", "url", url)
+		result.NotModified = true
+		return result, nil
+	}
+	if statusCode != 0 {
+		if statusErr := checkHTTPStatus(url, statusCode, statusHeader); statusErr != nil {
+			return result, statusErr
+		}
+	}
+	if nonHTML != nil && (title != "" || extractErr != nil) {
+		result.Title = title
+		return result, extractErr
+	}
 	if err != nil {
-		f.logger.Error(err, "Failed to visit URL with Colly", "url", url)
-		return "", fmt.Errorf("failed to visit URL: %w", err)
+		return result, fmt.Errorf("failed to visit URL: %w", err)
 	}
 
 	if title == "" {
 		f.logger.V(2).Info("Debug: No title found", "url", url)
-		return "", fmt.Errorf("no title found for URL: %s", url)
+		if extractErr != nil {
+			return result, fmt.Errorf("failed to extract title: %w", extractErr)
+		}
+		return result, fmt.Errorf("no title found for URL: %s", url)
 	}
 
 	f.logger.V(1).Info("Debug: Successfully fetched title with Colly", "originalURL", url, "finalURL", finalURL, "title", title)
-	return title, nil
+	result.Title = title
+	result.Description = description
+	return result, nil
+}
+
+// contextTransport binds every request made through it to ctx, since the
+// Colly collector has no way to accept a context for its visits.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
 }
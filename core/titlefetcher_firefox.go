@@ -0,0 +1,286 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mitchellh/go-homedir"
+)
+
+type FirefoxTitleFetcher struct {
+	logger logr.Logger
+}
+
+func NewFirefoxTitleFetcher(logger logr.Logger) *FirefoxTitleFetcher {
+	logger.V(1).Info("Debug: Creating new FirefoxTitleFetcher")
+	return &FirefoxTitleFetcher{
+		logger: logger,
+	}
+}
+
+func (f *FirefoxTitleFetcher) FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
+	f.logger.V(1).Info("Debug: Fetching titles from Firefox history", "urlCount", len(urls))
+
+	profileDirs, err := f.discoverProfiles()
+	if err != nil {
+		f.logger.Error(err, "Failed to discover Firefox profiles")
+		return nil, fmt.Errorf("failed to discover Firefox profiles: %w", err)
+	}
+	if len(profileDirs) == 0 {
+		return nil, fmt.Errorf("no Firefox profiles found")
+	}
+
+	historyItems := make(map[string]HistoryItem)
+	var lastErr error
+	for _, profileDir := range profileDirs {
+		if ctx.Err() != nil {
+			break
+		}
+		items, err := f.getTitlesForURLs(ctx, profileDir, urls)
+		if err != nil {
+			f.logger.V(1).Info("Debug: Failed to read Firefox profile history", "profile", profileDir, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		for url, item := range items {
+			if existing, ok := historyItems[url]; !ok || item.LastVisit.After(existing.LastVisit) {
+				historyItems[url] = item
+			}
+		}
+	}
+
+	if len(historyItems) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("failed to fetch titles: %w", lastErr)
+	}
+
+	titles := make(map[string]TitleResult)
+	for _, url := range urls {
+		if item, ok := historyItems[url.URL]; ok {
+			f.logger.V(2).Info("Debug: Found title in Firefox history", "url", url.URL, "title", item.Title)
+			titles[url.URL] = TitleResult{Title: item.Title, Fetcher: "firefox"}
+		} else {
+			f.logger.V(2).Info("Debug: No title found in Firefox history", "url", url.URL)
+			titles[url.URL] = TitleResult{}
+		}
+	}
+
+	return titles, nil
+}
+
+func (f *FirefoxTitleFetcher) discoverProfiles() ([]string, error) {
+	root, err := firefoxRootDir()
+	if err != nil {
+		return nil, err
+	}
+	f.logger.V(3).Info("Debug: Firefox root directory", "path", root)
+
+	file, err := os.Open(filepath.Join(root, "profiles.ini"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profiles.ini: %w", err)
+	}
+	defer file.Close()
+
+	profiles, err := parseFirefoxProfilesINI(file, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profiles.ini: %w", err)
+	}
+
+	var profileDirs []string
+	for _, profile := range profiles {
+		if _, err := os.Stat(filepath.Join(profile, "places.sqlite")); err != nil {
+			f.logger.V(2).Info("Debug: Skipping Firefox profile without places.sqlite", "profile", profile)
+			continue
+		}
+		profileDirs = append(profileDirs, profile)
+	}
+
+	f.logger.V(2).Info("Debug: Discovered Firefox profiles", "count", len(profileDirs))
+	return profileDirs, nil
+}
+
+func (f *FirefoxTitleFetcher) getTitlesForURLs(ctx context.Context, profileDir string, urls []urlRecord) (map[string]HistoryItem, error) {
+	f.logger.V(2).Info("Debug: Getting titles from Firefox profile", "profile", profileDir, "urlCount", len(urls))
+
+	snapshotDir, err := os.MkdirTemp("", "hollowbeak-firefox-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(snapshotDir)
+
+	// places.sqlite is held open in WAL mode while Firefox runs, so the
+	// write-ahead log has to be copied alongside it for recent visits.
+	for _, name := range []string{"places.sqlite", "places.sqlite-wal"} {
+		src := filepath.Join(profileDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyFile(src, filepath.Join(snapshotDir, name)); err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", name, err)
+		}
+	}
+
+	snapshotFile := filepath.Join(snapshotDir, "places.sqlite")
+	f.logger.V(3).Info("Debug: Opening SQLite database", "path", snapshotFile)
+	db, err := sql.Open("sqlite3", snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	placeholders := make([]string, len(urls))
+	args := make([]interface{}, len(urls))
+	for i, url := range urls {
+		placeholders[i] = "?"
+		args[i] = url.URL
+	}
+
+	query := fmt.Sprintf(`
+ SELECT
+ 	url,
+ 	COALESCE(title, ''),
+ 	COALESCE(last_visit_date, 0)
+ FROM
+ 	moz_places
+ WHERE
+ 	url IN (%s)
+ ORDER BY
+ 	last_visit_date DESC
+`, strings.Join(placeholders, ","))
+
+	f.logger.V(3).Info("Debug: Executing SQL query", "query", query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	historyItems := make(map[string]HistoryItem)
+	count := 1
+	currentTime := time.Now()
+	for rows.Next() {
+		var item HistoryItem
+		var lastVisit int64
+		if err := rows.Scan(&item.URL, &item.Title, &lastVisit); err != nil {
+			return nil, err
+		}
+		if item.Title == "" {
+			continue
+		}
+		// moz_places stores visit times as microseconds since the Unix epoch.
+		item.LastVisit = time.UnixMicro(lastVisit)
+		item.RelativeVisit = formatRelativeTime(currentTime, item.LastVisit)
+		item.Count = count
+		count++
+
+		if _, ok := historyItems[item.URL]; !ok {
+			historyItems[item.URL] = item
+		}
+		f.logger.V(3).Info("Debug: Processed history item", "url", item.URL, "title", item.Title)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	f.logger.V(2).Info("Debug: Finished getting titles from Firefox profile", "itemCount", len(historyItems))
+	return historyItems, nil
+}
+
+func firefoxRootDir() (string, error) {
+	var dir string
+	switch runtime.GOOS {
+	case "darwin":
+		dir = "~/Library/Application Support/Firefox"
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "Mozilla", "Firefox"), nil
+	default:
+		dir = "~/.mozilla/firefox"
+	}
+
+	expanded, err := homedir.Expand(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand Firefox directory: %w", err)
+	}
+	return expanded, nil
+}
+
+// parseFirefoxProfilesINI returns the absolute profile directories listed in
+// profiles.ini, with the default profile first.
+func parseFirefoxProfilesINI(reader io.Reader, root string) ([]string, error) {
+	type profileSection struct {
+		path       string
+		isRelative bool
+		isDefault  bool
+	}
+
+	var profiles []*profileSection
+	var current *profileSection
+	installDefaults := make(map[string]bool)
+	inInstall := false
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := line[1 : len(line)-1]
+			current = nil
+			inInstall = strings.HasPrefix(section, "Install")
+			if strings.HasPrefix(section, "Profile") {
+				current = &profileSection{}
+				profiles = append(profiles, current)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case inInstall && key == "Default":
+			installDefaults[value] = true
+		case current != nil && key == "Path":
+			current.path = value
+		case current != nil && key == "IsRelative":
+			current.isRelative = value == "1"
+		case current != nil && key == "Default":
+			current.isDefault = value == "1"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var defaults, others []string
+	for _, profile := range profiles {
+		if profile.path == "" {
+			continue
+		}
+		dir := filepath.FromSlash(profile.path)
+		if profile.isRelative {
+			dir = filepath.Join(root, dir)
+		}
+		if profile.isDefault || installDefaults[profile.path] {
+			defaults = append(defaults, dir)
+		} else {
+			others = append(others, dir)
+		}
+	}
+
+	return append(defaults, others...), nil
+}
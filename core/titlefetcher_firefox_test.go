@@ -0,0 +1,50 @@
+package core
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFirefoxProfilesINI(t *testing.T) {
+	ini := `
+[Install4F96D1932A9F858E]
+Default=Profiles/abcd.default-release
+Locked=1
+
+[Profile1]
+Name=default
+IsRelative=1
+Path=Profiles/efgh.default
+
+[Profile0]
+Name=default-release
+IsRelative=1
+Path=Profiles/abcd.default-release
+
+[Profile2]
+Name=elsewhere
+IsRelative=0
+Path=/data/firefox/work
+
+[General]
+StartWithLastProfile=1
+Version=2
+`
+	root := filepath.FromSlash("/home/user/.mozilla/firefox")
+
+	got, err := parseFirefoxProfilesINI(strings.NewReader(ini), root)
+	if err != nil {
+		t.Fatalf("parseFirefoxProfilesINI failed: %v", err)
+	}
+
+	want := []string{
+		filepath.Join(root, "Profiles", "abcd.default-release"),
+		filepath.Join(root, "Profiles", "efgh.default"),
+		filepath.FromSlash("/data/firefox/work"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
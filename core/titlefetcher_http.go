@@ -1,78 +1,219 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 )
 
+// DefaultMaxBodyBytes is how much of a response body is read when looking for
+// its title. Titles sit in the document head, well within this limit.
+const DefaultMaxBodyBytes = 2 << 20
+
+// pdfTailBytes is how much of the end of a PDF longer than the body limit is
+// fetched to find its trailer.
+const pdfTailBytes = 256 << 10
+
+// TitleFetcher resolves titles for a batch of URLs. Implementations must stop
+// work and return promptly once ctx is done, returning whatever titles they
+// resolved so far. An error is returned only when the fetcher as a whole
+// cannot run; failures for individual URLs are reported in their TitleResult.
 type TitleFetcher interface {
-	FetchTitles(urls []urlRecord) (map[string]string, error)
+	FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error)
+}
+
+// TitleResult is the outcome of looking up the title of a single URL. An empty
+// Title with a nil Err means the fetcher simply had no title for the URL.
+type TitleResult struct {
+	Title string
+	// FinalURL is the URL the response came from after following redirects.
+	FinalURL    string
+	StatusCode  int
+	ContentType string
+	// Description is the page's meta description, if it has one.
+	Description string
+	// ETag, LastModified and FreshUntil are the response's validators and
+	// the end of its freshness lifetime, used to revalidate it later.
+	ETag         string
+	LastModified string
+	FreshUntil   time.Time
+	// NotModified is set when the server confirmed the cached title with
+	// 304 Not Modified; Title is then empty.
+	NotModified bool
+	// Fetcher names the fetcher that produced the result, "cache" for titles
+	// served from the cache or "override" for titles from the overrides file.
+	Fetcher string
+	// Duration is how long the fetch took, including any retries, unless the
+	// fetcher timed just the final attempt itself.
+	Duration time.Duration
+	Err      error
 }
 
 type HTTPTitleFetcher struct {
-	logger logr.Logger
-	client *http.Client
+	logger       logr.Logger
+	client       *http.Client
+	limits       ConcurrencyLimits
+	retries      RetryPolicies
+	maxBodyBytes int64
+	titleSources []string
 }
 
-func NewHTTPTitleFetcher(logger logr.Logger) *HTTPTitleFetcher {
+func NewHTTPTitleFetcher(logger logr.Logger, options FetcherOptions) *HTTPTitleFetcher {
 	logger.V(1).Info("Debug: Creating new HTTPTitleFetcher")
 	return &HTTPTitleFetcher{
-		logger: logger,
-		client: &http.Client{},
+		logger:       logger,
+		client:       &http.Client{},
+		limits:       options.Concurrency,
+		retries:      options.Retries,
+		maxBodyBytes: maxBodyBytesOrDefault(options.MaxBodyBytes),
+		titleSources: options.TitleSources,
 	}
 }
 
-func (f *HTTPTitleFetcher) FetchTitles(urls []urlRecord) (map[string]string, error) {
+func (f *HTTPTitleFetcher) FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
 	f.logger.V(1).Info("Debug: Fetching titles", "urlCount", len(urls))
 
-	titles := make(map[string]string)
-	for _, url := range urls {
-		title, err := f.fetchTitle(url.URL)
-		if err != nil {
-			f.logger.Error(err, "Failed to fetch title", "url", url.URL)
-			titles[url.URL] = ""
-		} else {
-			titles[url.URL] = title
-		}
-	}
+	records := recordsByURL(urls)
+	titles := fetchTitlesConcurrently(ctx, f.logger, "http", urls, f.limits, f.retries, func(ctx context.Context, url string) (TitleResult, error) {
+		return f.fetchTitle(ctx, records[url])
+	})
 
 	return titles, nil
 }
 
-func (f *HTTPTitleFetcher) fetchTitle(url string) (string, error) {
+func (f *HTTPTitleFetcher) fetchTitle(ctx context.Context, record urlRecord) (TitleResult, error) {
+	url := record.URL
 	f.logger.V(2).Info("Debug: Creating HTTP request", "url", url)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		f.logger.Error(err, "Failed to create HTTP request", "url", url)
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+		return TitleResult{}, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	f.logger.V(2).Info("Debug: Setting User-Agent header")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	setConditionalHeaders(req.Header, record)
 
 	f.logger.V(2).Info("Debug: Sending HTTP request", "url", url)
 	resp, err := f.client.Do(req)
 	if err != nil {
 		f.logger.Error(err, "Failed to make HTTP request", "url", url)
-		return "", fmt.Errorf("failed to make HTTP request: %w", err)
+		return TitleResult{}, fmt.Errorf("failed to make HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	f.logger.V(2).Info("Debug: HTTP request successful", "url", url, "status", resp.Status)
 
+	result := TitleResult{
+		FinalURL:    resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	recordCacheHeaders(&result, resp.Header, time.Now())
+
+	if resp.StatusCode == http.StatusNotModified {
+		f.logger.V(1).Info("Debug: Cached title is still current", "url", url)
+		result.NotModified = true
+		return result, nil
+	}
+
 	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
 		f.logger.V(2).Info("Debug: Encountered redirect", "url", url, "status", resp.Status, "location", resp.Header.Get("Location"))
 	}
 
+	if err := checkHTTPStatus(url, resp.StatusCode, resp.Header); err != nil {
+		f.logger.V(1).Info("Debug: Not extracting title from error response", "url", url, "status", resp.Status)
+		return result, err
+	}
+
+	if !isHTMLContentType(result.ContentType) {
+		f.logger.V(1).Info("Debug: Resolving title of non-HTML response", "url", url, "contentType", result.ContentType)
+		nonHTML := newNonHTMLResponse(url, result.FinalURL, resp.Header)
+		var body io.Reader
+		if nonHTML.needsBody() {
+			body, err = f.readPDF(ctx, resp)
+			if err != nil {
+				return result, err
+			}
+		}
+		result.Title, err = resolveNonHTMLTitle(f.logger, nonHTML, body)
+		return result, err
+	}
+
 	f.logger.V(2).Info("Debug: Extracting title from response body", "url", url)
-	title, err := extractTitle(f.logger, resp.Body)
+	body := io.LimitReader(resp.Body, f.maxBodyBytes)
+	summary, err := summarizePage(f.logger, body, responseInfo{
+		RequestURL:  url,
+		FinalURL:    result.FinalURL,
+		ContentType: result.ContentType,
+	}, f.titleSources)
 	if err != nil {
-		f.logger.Error(err, "Failed to extract title", "url", url)
-		return "", fmt.Errorf("failed to extract title: %w", err)
+		f.logger.V(1).Info("Debug: Failed to extract title", "url", url, "error", err.Error())
+		return result, fmt.Errorf("failed to extract title: %w", err)
 	}
 
-	f.logger.V(1).Info("Debug: Successfully fetched title", "url", url, "title", title)
-	return title, nil
+	f.logger.V(1).Info("Debug: Successfully fetched title", "url", url, "title", summary.Title)
+	result.Title = summary.Title
+	result.Description = summary.Description
+	return result, nil
+}
+
+// readPDF reads a PDF response up to maxBodyBytes. The trailer that points
+// at the document's Info dictionary is at the end of the file, so when the
+// file is longer and the server accepts range requests, its last
+// pdfTailBytes are fetched as well.
+func (f *HTTPTitleFetcher) readPDF(ctx context.Context, resp *http.Response) (io.Reader, error) {
+	head, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	if int64(len(head)) < f.maxBodyBytes || resp.Header.Get("Accept-Ranges") != "bytes" || pdfTitle(head) != "" {
+		return bytes.NewReader(head), nil
+	}
+
+	url := resp.Request.URL.String()
+	f.logger.V(2).Info("Debug: Fetching end of PDF", "url", url)
+	tail, err := f.fetchTail(ctx, url, pdfTailBytes)
+	if err != nil {
+		f.logger.V(1).Info("Debug: Failed to fetch end of PDF", "url", url, "error", err.Error())
+		return bytes.NewReader(head), nil
+	}
+	return io.MultiReader(bytes.NewReader(head), strings.NewReader("\n"), bytes.NewReader(tail)), nil
+}
+
+// fetchTail returns the last n bytes of url using a range request.
+func (f *HTTPTitleFetcher) fetchTail(ctx context.Context, url string, n int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	req.Header.Set("Range", fmt.Sprintf("bytes=-%d", n))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range request answered with %s", resp.Status)
+	}
+	tail, err := io.ReadAll(io.LimitReader(resp.Body, n))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read end of PDF: %w", err)
+	}
+	return tail, nil
+}
+
+func maxBodyBytesOrDefault(n int64) int64 {
+	if n <= 0 {
+		return DefaultMaxBodyBytes
+	}
+	return n
 }
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestHTTPTitleFetcherStatusErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, "<html><head><title>Hello</title></head></html>")
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<html><head><title>404 Not Found</title></head></html>")
+		case "/denied":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<html><head><title>Access Denied</title></head></html>")
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewHTTPTitleFetcher(testr.New(t), FetcherOptions{})
+	results, err := fetcher.FetchTitles(context.Background(), []urlRecord{
+		newURLRecord(server.URL + "/ok"),
+		newURLRecord(server.URL + "/missing"),
+		newURLRecord(server.URL + "/denied"),
+	})
+	if err != nil {
+		t.Fatalf("FetchTitles failed: %v", err)
+	}
+
+	if got := results[server.URL+"/ok"]; got.Title != "Hello" || got.Err != nil {
+		t.Errorf("/ok: got %+v", got)
+	}
+
+	for path, status := range map[string]int{"/missing": http.StatusNotFound, "/denied": http.StatusForbidden} {
+		got := results[server.URL+path]
+		if got.Title != "" {
+			t.Errorf("%s: title = %q, want none", path, got.Title)
+		}
+		if code := StatusCodeOf(got.Err); code != status {
+			t.Errorf("%s: status = %d, want %d (err %v)", path, code, status, got.Err)
+		}
+	}
+}
+
+func TestHTTPTitleFetcherRecordsResponseMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><head><title>Moved</title></head></html>")
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewHTTPTitleFetcher(testr.New(t), FetcherOptions{})
+	results, err := fetcher.FetchTitles(context.Background(), []urlRecord{newURLRecord(server.URL + "/old")})
+	if err != nil {
+		t.Fatalf("FetchTitles failed: %v", err)
+	}
+
+	got := results[server.URL+"/old"]
+	if got.Title != "Moved" || got.Err != nil {
+		t.Fatalf("got %+v", got)
+	}
+	if got.FinalURL != server.URL+"/new" {
+		t.Errorf("FinalURL = %q, want %q", got.FinalURL, server.URL+"/new")
+	}
+	if got.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", got.StatusCode, http.StatusOK)
+	}
+	if got.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("ContentType = %q", got.ContentType)
+	}
+	if got.Fetcher != "http" {
+		t.Errorf("Fetcher = %q, want %q", got.Fetcher, "http")
+	}
+	if got.Duration <= 0 {
+		t.Errorf("Duration = %v, want > 0", got.Duration)
+	}
+}
@@ -1,10 +1,10 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,59 +14,108 @@ import (
 )
 
 type SQLTitleFetcher struct {
-	logger logr.Logger
+	logger       logr.Logger
+	historyFiles []string
 }
 
-func NewSQLTitleFetcher(logger logr.Logger) *SQLTitleFetcher {
+// NewSQLTitleFetcher returns a fetcher that reads titles from Chromium-family
+// browser history. When historyFiles is empty the history databases of all
+// installed Chromium browsers and profiles are discovered automatically.
+func NewSQLTitleFetcher(logger logr.Logger, historyFiles []string) *SQLTitleFetcher {
 	logger.V(1).Info("Debug: Creating new SQLTitleFetcher")
 	return &SQLTitleFetcher{
-		logger: logger,
+		logger:       logger,
+		historyFiles: historyFiles,
 	}
 }
 
-func (f *SQLTitleFetcher) FetchTitles(urls []urlRecord) (map[string]string, error) {
+func (f *SQLTitleFetcher) FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
 	f.logger.V(1).Info("Debug: Fetching titles from SQL database", "urlCount", len(urls))
 
-	f.logger.V(2).Info("Debug: Getting titles for URLs")
-	historyItems, query, err := f.getTitlesForURLs(urls)
+	historyFiles, err := f.resolveHistoryFiles()
 	if err != nil {
-		f.logger.Error(err, "Failed to fetch titles")
-		return nil, fmt.Errorf("failed to fetch titles: %w", err)
+		f.logger.Error(err, "Failed to resolve history files")
+		return nil, fmt.Errorf("failed to resolve history files: %w", err)
+	}
+	if len(historyFiles) == 0 {
+		return nil, fmt.Errorf("no Chromium history files found")
+	}
+
+	historyItems := make(map[string]HistoryItem)
+	var lastErr error
+	for _, historyFile := range historyFiles {
+		if ctx.Err() != nil {
+			break
+		}
+		f.logger.V(2).Info("Debug: Getting titles for URLs", "historyFile", historyFile)
+		items, query, err := f.getTitlesForURLs(ctx, historyFile, urls)
+		if err != nil {
+			f.logger.V(1).Info("Debug: Failed to read history file", "historyFile", historyFile, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		f.logger.V(3).Info("Debug: SQL query executed", "query", query)
+
+		for url, item := range items {
+			if existing, ok := historyItems[url]; !ok || item.LastVisit.After(existing.LastVisit) {
+				historyItems[url] = item
+			}
+		}
 	}
-	f.logger.V(3).Info("Debug: SQL query executed", "query", query)
 
-	titles := make(map[string]string)
+	if len(historyItems) == 0 && lastErr != nil {
+		f.logger.Error(lastErr, "Failed to fetch titles")
+		return nil, fmt.Errorf("failed to fetch titles: %w", lastErr)
+	}
+
+	titles := make(map[string]TitleResult)
 	for _, url := range urls {
 		if item, ok := historyItems[url.URL]; ok {
 			f.logger.V(2).Info("Debug: Found title in database", "url", url.URL, "title", item.Title)
-			titles[url.URL] = item.Title
+			titles[url.URL] = TitleResult{Title: item.Title, Fetcher: "sql"}
 		} else {
 			f.logger.V(2).Info("Debug: No title found in database", "url", url.URL)
-			titles[url.URL] = ""
+			titles[url.URL] = TitleResult{}
 		}
 	}
 
 	return titles, nil
 }
 
-func (f *SQLTitleFetcher) getTitlesForURLs(urls []urlRecord) (map[string]HistoryItem, string, error) {
+func (f *SQLTitleFetcher) resolveHistoryFiles() ([]string, error) {
+	if len(f.historyFiles) == 0 {
+		return discoverChromiumHistoryFiles(f.logger), nil
+	}
+
+	var historyFiles []string
+	for _, historyFile := range f.historyFiles {
+		expanded, err := homedir.Expand(historyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand history file path: %w", err)
+		}
+		historyFiles = append(historyFiles, expanded)
+	}
+	return historyFiles, nil
+}
+
+func (f *SQLTitleFetcher) getTitlesForURLs(ctx context.Context, historyFilePath string, urls []urlRecord) (map[string]HistoryItem, string, error) {
 	f.logger.V(2).Info("Debug: Getting titles for URLs", "urlCount", len(urls))
+	f.logger.V(3).Info("Debug: Chromium history file path", "path", historyFilePath)
 
-	historyFilePath, err := homedir.Expand("~/Library/Application Support/Google/Chrome/Default/History")
+	tempFile, err := os.CreateTemp("", "hollowbeak-history-*.db")
 	if err != nil {
-		f.logger.Error(err, "Failed to expand history file path")
-		return nil, "", fmt.Errorf("failed to expand history file path: %v", err)
+		return nil, "", fmt.Errorf("failed to create history backup file: %w", err)
 	}
-	f.logger.V(3).Info("Debug: Chrome history file path", "path", historyFilePath)
+	tempFile.Close()
+	backupFile := tempFile.Name()
+	defer os.Remove(backupFile)
 
-	backupFile := filepath.Join(os.TempDir(), "history_backup.db")
 	f.logger.V(3).Info("Debug: Creating history backup", "backupPath", backupFile)
 	err = f.createHistoryBackup(historyFilePath, backupFile)
 	if err != nil {
 		f.logger.Error(err, "Failed to create history backup")
 		return nil, "", err
 	}
-	defer os.Remove(backupFile)
 
 	f.logger.V(3).Info("Debug: Opening SQLite database", "path", backupFile)
 	db, err := sql.Open("sqlite3", backupFile+"?mode=rw")
@@ -76,13 +125,13 @@ func (f *SQLTitleFetcher) getTitlesForURLs(urls []urlRecord) (map[string]History
 	}
 	defer db.Close()
 
-	_, err = db.Exec("PRAGMA query_log = on;")
+	_, err = db.ExecContext(ctx, "PRAGMA query_log = on;")
 	if err != nil {
 		f.logger.Error(err, "Failed to enable query logging")
 		return nil, "", err
 	}
 
-	_, err = db.Exec(`
+	_, err = db.ExecContext(ctx, `
    	CREATE TABLE IF NOT EXISTS query_log (
    		time DATETIME DEFAULT CURRENT_TIMESTAMP,
    		query TEXT
@@ -119,7 +168,7 @@ func (f *SQLTitleFetcher) getTitlesForURLs(urls []urlRecord) (map[string]History
 	}
 
 	f.logger.V(3).Info("Debug: Executing SQL query")
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		f.logger.Error(err, "Failed to execute SQL query")
 		return nil, query, err
@@ -138,16 +187,22 @@ func (f *SQLTitleFetcher) getTitlesForURLs(urls []urlRecord) (map[string]History
 			f.logger.Error(err, "Failed to scan SQL row")
 			return nil, query, err
 		}
+		if item.Title == "" {
+			continue
+		}
 		item.LastVisit, err = time.ParseInLocation("2006-01-02 15:04:05", visitTimeStr, time.Local)
 		if err != nil {
 			f.logger.Error(err, "Failed to parse visit time")
 			return nil, query, err
 		}
-		item.RelativeVisit = f.formatRelativeTime(currentTime, item.LastVisit)
+		item.RelativeVisit = formatRelativeTime(currentTime, item.LastVisit)
 		item.Count = count
 		count++
 
-		historyItems[item.URL] = item
+		// Rows arrive newest visit first; keep the most recent title per URL.
+		if _, ok := historyItems[item.URL]; !ok {
+			historyItems[item.URL] = item
+		}
 		f.logger.V(3).Info("Debug: Processed history item", "url", item.URL, "title", item.Title)
 	}
 
@@ -165,15 +220,9 @@ func (f *SQLTitleFetcher) getTitlesForURLs(urls []urlRecord) (map[string]History
 
 func (f *SQLTitleFetcher) createHistoryBackup(src, dst string) error {
 	f.logger.V(2).Info("Debug: Creating history backup", "src", src, "dst", dst)
-	input, err := os.ReadFile(src)
-	if err != nil {
-		f.logger.Error(err, "Failed to read source file")
-		return err
-	}
-
-	err = os.WriteFile(dst, input, 0o644)
+	err := copyFile(src, dst)
 	if err != nil {
-		f.logger.Error(err, "Failed to write destination file")
+		f.logger.Error(err, "Failed to copy history file")
 		return err
 	}
 
@@ -181,30 +230,38 @@ func (f *SQLTitleFetcher) createHistoryBackup(src, dst string) error {
 	return nil
 }
 
-func (f *SQLTitleFetcher) formatRelativeTime(currentTime, visitTime time.Time) string {
+func formatRelativeTime(currentTime, visitTime time.Time) string {
 	duration := currentTime.Sub(visitTime)
 
 	if duration < time.Minute {
 		return fmt.Sprintf("%d seconds ago", int(duration.Seconds()))
 	} else if duration < time.Hour {
 		minutes := int(duration.Minutes())
-		return fmt.Sprintf("%d %s ago", minutes, f.pluralize("minute", minutes))
+		return fmt.Sprintf("%d %s ago", minutes, pluralize("minute", minutes))
 	} else if duration < 24*time.Hour {
 		hours := int(duration.Hours())
-		return fmt.Sprintf("%d %s ago", hours, f.pluralize("hour", hours))
+		return fmt.Sprintf("%d %s ago", hours, pluralize("hour", hours))
 	} else {
 		days := int(duration.Hours() / 24)
-		return fmt.Sprintf("%d %s ago", days, f.pluralize("day", days))
+		return fmt.Sprintf("%d %s ago", days, pluralize("day", days))
 	}
 }
 
-func (f *SQLTitleFetcher) pluralize(word string, count int) string {
+func pluralize(word string, count int) string {
 	if count == 1 {
 		return word
 	}
 	return word + "s"
 }
 
+func copyFile(src, dst string) error {
+	input, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, input, 0o644)
+}
+
 type HistoryItem struct {
 	URL           string
 	Title         string
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+// writeChromiumHistory creates a History database in which url was last
+// visited at visit under title.
+func writeChromiumHistory(t *testing.T, path, url, title string, visit time.Time) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Chromium stores visit times as microseconds since 1601-01-01.
+	visitTime := visit.UnixMicro() + 11644473600*1000000
+	for _, stmt := range []string{
+		`CREATE TABLE urls (id INTEGER PRIMARY KEY, url TEXT NOT NULL, title TEXT NOT NULL)`,
+		`CREATE TABLE visits (id INTEGER PRIMARY KEY, url INTEGER NOT NULL, visit_time INTEGER NOT NULL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO urls (id, url, title) VALUES (1, ?, ?)`, url, title); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO visits (url, visit_time) VALUES (1, ?)`, visitTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLTitleFetcherSkipsUntitledVisits(t *testing.T) {
+	dir := t.TempDir()
+	url := "https://a.example/"
+	titled := filepath.Join(dir, "Default", "History")
+	untitled := filepath.Join(dir, "Profile 1", "History")
+	for _, path := range []string{titled, untitled} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeChromiumHistory(t, titled, url, "Titled", time.Now().Add(-48*time.Hour))
+	writeChromiumHistory(t, untitled, url, "", time.Now().Add(-time.Hour))
+
+	fetcher := NewSQLTitleFetcher(testr.New(t), []string{titled, untitled})
+	results, err := fetcher.FetchTitles(context.Background(), []urlRecord{newURLRecord(url)})
+	if err != nil {
+		t.Fatalf("FetchTitles failed: %v", err)
+	}
+	if got := results[url].Title; got != "Titled" {
+		t.Errorf("title = %q, want %q", got, "Titled")
+	}
+}
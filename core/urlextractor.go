@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -14,6 +16,9 @@ type URLExtractor struct {
 	cache         *Cache
 	titleFetchers []TitleFetcher
 	noCache       bool
+	retryFailed   bool
+	overrides     map[string]string
+	canonicalizer *URLCanonicalizer
 }
 
 func NewURLExtractor(
@@ -21,22 +26,39 @@ func NewURLExtractor(
 	reader io.Reader,
 	titleFetchers []TitleFetcher,
 	noCache bool,
+	cacheOptions CacheOptions,
 ) (*URLExtractor, error) {
 	var cache *Cache
 	var err error
 	if !noCache {
-		cache, err = NewCache(logger)
+		cache, err = NewCache(logger, cacheOptions)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create cache: %w", err)
 		}
 	}
 
+	canonicalizer := NewURLCanonicalizer(cacheOptions.Canonicalize)
+	overrides := make(map[string]string)
+	if cacheOptions.OverridesFile != "" {
+		fileOverrides, err := LoadTitleOverrides(cacheOptions.OverridesFile)
+		if err != nil {
+			return nil, err
+		}
+		for url, title := range fileOverrides {
+			overrides[canonicalizer.Canonicalize(url)] = title
+		}
+		logger.V(1).Info("Debug: Loaded title overrides", "path", cacheOptions.OverridesFile, "count", len(overrides))
+	}
+
 	return &URLExtractor{
 		logger:        logger,
 		reader:        reader,
 		cache:         cache,
 		titleFetchers: titleFetchers,
 		noCache:       noCache,
+		retryFailed:   cacheOptions.RetryFailed,
+		overrides:     overrides,
+		canonicalizer: canonicalizer,
 	}, nil
 }
 
@@ -60,44 +82,163 @@ func (ue *URLExtractor) ExtractURLs() ([]urlRecord, error) {
 	return urls, nil
 }
 
-func (ue *URLExtractor) GetOrFetchTitles(urls []urlRecord) (map[string]string, error) {
-	titles := make(map[string]string)
+// GetOrFetchTitles resolves titles from the overrides file, the cache and then
+// each fetcher in turn. URLs that no fetcher resolved carry the most
+// significant error reported for them, if any.
+//
+// URLs with the same canonical form are resolved once, using the first way
+// they were written, and cached under the canonical URL. Entries cached under
+// a URL as it was written are moved to its canonical URL.
+func (ue *URLExtractor) GetOrFetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
+	keys := make(map[string]string, len(urls))
+	seen := make(map[string]bool, len(urls))
+	unique := make([]urlRecord, 0, len(urls))
+	for _, url := range urls {
+		if _, ok := keys[url.URL]; ok {
+			continue
+		}
+		key := ue.canonicalizer.Canonicalize(url.URL)
+		keys[url.URL] = key
+		if !ue.noCache {
+			ue.cache.Rekey(key, url.URL)
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, url)
+		}
+	}
+	ue.logger.V(2).Info("Debug: Deduplicated URLs", "count", len(urls), "unique", len(unique))
+
+	resolved, err := ue.resolveTitles(ctx, unique, keys)
+	titles := make(map[string]TitleResult, len(keys))
+	for url, key := range keys {
+		if result, ok := resolved[key]; ok {
+			titles[url] = result
+		}
+	}
+	return titles, err
+}
+
+// resolveTitles resolves titles for urls, which have distinct canonical keys,
+// and returns them by key.
+func (ue *URLExtractor) resolveTitles(ctx context.Context, urls []urlRecord, keys map[string]string) (map[string]TitleResult, error) {
+	titles := make(map[string]TitleResult)
+	failures := make(map[string]TitleResult)
 	urlsToFetch := make([]urlRecord, 0)
 
-	if ue.noCache {
-		urlsToFetch = urls
-	} else {
-		for _, url := range urls {
-			if title, ok := ue.cache.Get(url.URL); ok {
-				ue.logger.V(1).Info("Debug: Title found in cache", "url", url.URL, "title", title)
-				titles[url.URL] = title
-			} else {
-				urlsToFetch = append(urlsToFetch, url)
+	for _, url := range urls {
+		key := keys[url.URL]
+		if title, ok := ue.overrides[key]; ok {
+			ue.logger.V(1).Info("Debug: Title found in overrides", "url", url.URL, "title", title)
+			titles[key] = TitleResult{Title: title, Fetcher: "override"}
+			continue
+		}
+		if ue.noCache {
+			urlsToFetch = append(urlsToFetch, url)
+			continue
+		}
+
+		if result, ok := ue.cache.GetResult(key); ok {
+			ue.logger.V(1).Info("Debug: Title found in cache", "url", url.URL, "title", result.Title)
+			result.Fetcher = "cache"
+			titles[key] = result
+		} else if reason, ok := ue.cache.GetFailure(key); ok && !ue.retryFailed {
+			ue.logger.V(1).Info("Debug: Failure found in cache", "url", url.URL, "reason", reason)
+			titles[key] = TitleResult{Fetcher: "cache", Err: &CachedFailureError{URL: url.URL, Reason: reason}}
+		} else {
+			if item, ok := ue.cache.Stale(key); ok {
+				ue.logger.V(1).Info("Debug: Revalidating expired title", "url", url.URL, "etag", item.ETag, "lastModified", item.LastModified)
+				url.ETag, url.LastModified = item.ETag, item.LastModified
 			}
+			urlsToFetch = append(urlsToFetch, url)
 		}
 	}
 
-	if len(urlsToFetch) > 0 {
-		ue.logger.V(1).Info("Debug: Fetching titles from web", "urlCount", len(urlsToFetch))
-		var lastErr error
-		for _, fetcher := range ue.titleFetchers {
-			fetchedTitles, err := fetcher.FetchTitles(urlsToFetch)
-			if err == nil {
-				for url, title := range fetchedTitles {
-					titles[url] = title
-					if !ue.noCache {
-						if err := ue.cache.Set(url, title); err != nil {
-							ue.logger.Error(err, "Failed to cache title", "url", url)
-						}
-					}
-				}
-				return titles, nil
-			}
+	if len(urlsToFetch) == 0 {
+		return titles, nil
+	}
+
+	ue.logger.V(1).Info("Debug: Fetching titles from web", "urlCount", len(urlsToFetch))
+	var lastErr error
+	anySucceeded := false
+	for _, fetcher := range ue.titleFetchers {
+		if len(urlsToFetch) == 0 || ctx.Err() != nil {
+			break
+		}
+
+		fetchedTitles, err := fetcher.FetchTitles(ctx, urlsToFetch)
+		if err != nil {
 			lastErr = err
 			ue.logger.V(2).Info("Debug: Fetcher failed, trying next", "error", err.Error())
+			continue
 		}
+		anySucceeded = true
+
+		// Only URLs this fetcher could not resolve are handed to the next one.
+		remaining := make([]urlRecord, 0, len(urlsToFetch))
+		for _, url := range urlsToFetch {
+			key := keys[url.URL]
+			result := fetchedTitles[url.URL]
+			if result.NotModified && !ue.noCache {
+				if revalidated, ok := ue.cache.Revalidate(key, result); ok {
+					delete(failures, key)
+					titles[key] = revalidated
+					continue
+				}
+			}
+			if result.Title == "" {
+				if previous := failures[key]; result.Err != nil && (previous.Err == nil || StatusCodeOf(previous.Err) == 0) {
+					failures[key] = result
+				}
+				remaining = append(remaining, url)
+				continue
+			}
+			delete(failures, key)
+			titles[key] = result
+			if !ue.noCache {
+				if err := ue.cache.SetResult(key, result); err != nil {
+					ue.logger.Error(err, "Failed to cache title", "url", url.URL)
+				}
+			}
+		}
+		ue.logger.V(2).Info("Debug: Fetcher finished", "resolved", len(urlsToFetch)-len(remaining), "remaining", len(remaining))
+		urlsToFetch = remaining
+	}
+
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		ue.logger.Info("Deadline reached, returning titles resolved so far", "unresolved", len(urlsToFetch))
+	case err != nil:
+		return titles, fmt.Errorf("title fetching interrupted: %w", err)
+	case !anySucceeded:
 		return titles, fmt.Errorf("all fetchers failed to fetch titles: %w", lastErr)
 	}
 
+	for _, url := range urlsToFetch {
+		ue.logger.V(1).Info("Debug: No fetcher resolved a title", "url", url.URL)
+		key := keys[url.URL]
+		failure := failures[key]
+		titles[key] = failure
+		if !ue.noCache && isCacheableFailure(failure.Err) {
+			if err := ue.cache.SetFailure(key, failure.Err.Error()); err != nil {
+				ue.logger.Error(err, "Failed to cache failure", "url", url.URL)
+			}
+		}
+	}
+
 	return titles, nil
 }
+
+// outputURL returns how url is written to the output.
+func (ue *URLExtractor) outputURL(url string) string {
+	if !ue.canonicalizer.options.RewriteOutput {
+		return url
+	}
+	return ue.canonicalizer.Canonicalize(url)
+}
+
+// isCacheableFailure reports whether err says something about the URL itself,
+// as opposed to the run being interrupted.
+func isCacheableFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
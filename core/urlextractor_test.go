@@ -0,0 +1,259 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+type stubTitleFetcher struct {
+	titles   map[string]string
+	failures map[string]error
+	err      error
+	asked    [][]string
+}
+
+func (f *stubTitleFetcher) FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
+	var asked []string
+	for _, u := range urls {
+		asked = append(asked, u.URL)
+	}
+	f.asked = append(f.asked, asked)
+	if f.err != nil {
+		return nil, f.err
+	}
+	titles := make(map[string]TitleResult)
+	for _, u := range urls {
+		titles[u.URL] = TitleResult{Title: f.titles[u.URL], Err: f.failures[u.URL]}
+	}
+	return titles, nil
+}
+
+func TestGetOrFetchTitlesFallsThroughPerURL(t *testing.T) {
+	history := &stubTitleFetcher{titles: map[string]string{"https://a.example": "A"}}
+	broken := &stubTitleFetcher{err: errors.New("boom")}
+	web := &stubTitleFetcher{titles: map[string]string{"https://b.example": "B"}}
+
+	extractor, err := NewURLExtractor(testr.New(t), strings.NewReader(""), []TitleFetcher{history, broken, web}, true, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []urlRecord{
+		newURLRecord("https://a.example"),
+		newURLRecord("https://b.example"),
+		newURLRecord("https://c.example"),
+	}
+	titles, err := extractor.GetOrFetchTitles(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("GetOrFetchTitles failed: %v", err)
+	}
+
+	want := map[string]string{"https://a.example": "A", "https://b.example": "B", "https://c.example": ""}
+	for url, title := range want {
+		if titles[url].Title != title {
+			t.Errorf("title for %s = %q, want %q", url, titles[url].Title, title)
+		}
+	}
+
+	if got := strings.Join(web.asked[0], ","); got != "https://b.example,https://c.example" {
+		t.Errorf("last fetcher was asked for %s", got)
+	}
+}
+
+func TestGetOrFetchTitlesAllFetchersFail(t *testing.T) {
+	broken := &stubTitleFetcher{err: errors.New("boom")}
+
+	extractor, err := NewURLExtractor(testr.New(t), strings.NewReader(""), []TitleFetcher{broken}, true, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := extractor.GetOrFetchTitles(context.Background(), []urlRecord{newURLRecord("https://a.example")}); err == nil {
+		t.Error("expected an error when every fetcher fails")
+	}
+}
+
+type blockingTitleFetcher struct{}
+
+func (blockingTitleFetcher) FetchTitles(ctx context.Context, urls []urlRecord) (map[string]TitleResult, error) {
+	<-ctx.Done()
+	return map[string]TitleResult{}, nil
+}
+
+func TestGetOrFetchTitlesReturnsPartialResultsAtDeadline(t *testing.T) {
+	history := &stubTitleFetcher{titles: map[string]string{"https://a.example": "A"}}
+
+	extractor, err := NewURLExtractor(testr.New(t), strings.NewReader(""), []TitleFetcher{history, blockingTitleFetcher{}}, true, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	titles, err := extractor.GetOrFetchTitles(ctx, []urlRecord{
+		newURLRecord("https://a.example"),
+		newURLRecord("https://b.example"),
+	})
+	if err != nil {
+		t.Fatalf("GetOrFetchTitles failed: %v", err)
+	}
+	if titles["https://a.example"].Title != "A" {
+		t.Errorf("title for https://a.example = %q, want %q", titles["https://a.example"].Title, "A")
+	}
+}
+
+func TestGetOrFetchTitlesCachesFailures(t *testing.T) {
+	logger := testr.New(t)
+	store, err := openJSONCacheStore(logger, filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCacheWithStore(logger, store)
+
+	newExtractor := func(fetcher TitleFetcher, retryFailed bool) *URLExtractor {
+		extractor, err := NewURLExtractor(logger, strings.NewReader(""), []TitleFetcher{fetcher}, true, CacheOptions{RetryFailed: retryFailed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		extractor.cache = cache
+		extractor.noCache = false
+		return extractor
+	}
+	urls := []urlRecord{newURLRecord("https://gone.example")}
+
+	failing := &stubTitleFetcher{failures: map[string]error{"https://gone.example": &HTTPStatusError{URL: "https://gone.example", StatusCode: 404}}}
+	if _, err := newExtractor(failing, false).GetOrFetchTitles(context.Background(), urls); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := &stubTitleFetcher{titles: map[string]string{"https://gone.example": "Back"}}
+	titles, err := newExtractor(fetcher, false).GetOrFetchTitles(context.Background(), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached *CachedFailureError
+	if !errors.As(titles["https://gone.example"].Err, &cached) {
+		t.Errorf("err = %v, want a cached failure", titles["https://gone.example"].Err)
+	}
+	if len(fetcher.asked) != 0 {
+		t.Errorf("fetcher was asked for %v despite the cached failure", fetcher.asked)
+	}
+
+	titles, err = newExtractor(fetcher, true).GetOrFetchTitles(context.Background(), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles["https://gone.example"].Title != "Back" {
+		t.Errorf("with RetryFailed, title = %q, want %q", titles["https://gone.example"].Title, "Back")
+	}
+}
+
+func TestGetOrFetchTitlesPrefersOverrides(t *testing.T) {
+	overridesFile := filepath.Join(t.TempDir(), "overrides.yaml")
+	if err := os.WriteFile(overridesFile, []byte("https://a.example: My title\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	web := &stubTitleFetcher{titles: map[string]string{"https://a.example": "Fetched", "https://b.example": "B"}}
+	extractor, err := NewURLExtractor(testr.New(t), strings.NewReader(""), []TitleFetcher{web}, true, CacheOptions{OverridesFile: overridesFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles, err := extractor.GetOrFetchTitles(context.Background(), []urlRecord{
+		newURLRecord("https://a.example"),
+		newURLRecord("https://b.example"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles["https://a.example"]; got.Title != "My title" || got.Fetcher != "override" {
+		t.Errorf("overridden URL = %+v", got)
+	}
+	if got := strings.Join(web.asked[0], ","); got != "https://b.example" {
+		t.Errorf("fetcher was asked for %s", got)
+	}
+}
+
+func TestGetOrFetchTitlesDeduplicatesCanonicalURLs(t *testing.T) {
+	web := &stubTitleFetcher{titles: map[string]string{"https://x.example/a": "A"}}
+	extractor, err := NewURLExtractor(testr.New(t), strings.NewReader(""), []TitleFetcher{web}, true, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []urlRecord{
+		newURLRecord("https://x.example/a"),
+		newURLRecord("https://x.example/a/"),
+		newURLRecord("https://X.example/a#frag"),
+		newURLRecord("https://x.example/a?utm_source=feed"),
+	}
+	titles, err := extractor.GetOrFetchTitles(context.Background(), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(web.asked) != 1 || len(web.asked[0]) != 1 {
+		t.Errorf("fetcher was asked for %v, want one URL", web.asked)
+	}
+	for _, url := range urls {
+		if got := titles[url.URL].Title; got != "A" {
+			t.Errorf("title of %s = %q, want %q", url.URL, got, "A")
+		}
+	}
+}
+
+func TestGetOrFetchTitlesMovesEntriesToCanonicalKeys(t *testing.T) {
+	logger := testr.New(t)
+	store, err := openJSONCacheStore(logger, filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCacheWithStore(logger, store)
+	if err := cache.Set("https://X.example", "Cached"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	web := &stubTitleFetcher{titles: map[string]string{"https://X.example": "Fetched"}}
+	extractor, err := NewURLExtractor(logger, strings.NewReader(""), []TitleFetcher{web}, true, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extractor.cache = cache
+	extractor.noCache = false
+
+	titles, err := extractor.GetOrFetchTitles(context.Background(), []urlRecord{newURLRecord("https://X.example")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles["https://X.example"].Title; got != "Cached" {
+		t.Errorf("title = %q, want %q", got, "Cached")
+	}
+	if len(web.asked) != 0 {
+		t.Errorf("fetcher was asked for %v despite the cached title", web.asked)
+	}
+
+	if err := cache.CleanupAndSave(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries["https://X.example"]; ok {
+		t.Error("entry is still stored under the URL as written")
+	}
+	if got := entries["https://x.example/"].Value; got != "Cached" {
+		t.Errorf("canonical entry = %q, want %q", got, "Cached")
+	}
+}
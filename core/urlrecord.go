@@ -2,8 +2,21 @@ package core
 
 type urlRecord struct {
 	URL string
+	// ETag and LastModified are the validators of an expired cached title,
+	// sent so that the server can confirm it with 304 Not Modified.
+	ETag         string
+	LastModified string
 }
 
 func newURLRecord(rawURL string) urlRecord {
 	return urlRecord{URL: rawURL}
 }
+
+// recordsByURL indexes urls by their URL.
+func recordsByURL(urls []urlRecord) map[string]urlRecord {
+	records := make(map[string]urlRecord, len(urls))
+	for _, url := range urls {
+		records[url.URL] = url
+	}
+	return records
+}
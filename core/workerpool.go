@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	DefaultConcurrency        = 8
+	DefaultPerHostConcurrency = 2
+)
+
+type ConcurrencyLimits struct {
+	// Global is the maximum number of URLs fetched at the same time.
+	Global int
+	// PerHost is the maximum number of URLs fetched at the same time from a
+	// single host.
+	PerHost int
+}
+
+func (l ConcurrencyLimits) normalized() ConcurrencyLimits {
+	if l.Global < 1 {
+		l.Global = DefaultConcurrency
+	}
+	if l.PerHost < 1 {
+		l.PerHost = DefaultPerHostConcurrency
+	}
+	if l.PerHost > l.Global {
+		l.PerHost = l.Global
+	}
+	return l
+}
+
+// fetchTitlesConcurrently calls fetchTitle for every distinct URL and records
+// fetcher as the source of each result. Every attempt holds a slot for its
+// host, of which there are limits.PerHost, and then one of the limits.Global
+// slots, so a busy host does not keep the others waiting. Slots are given back
+// while a failed attempt waits to be retried. URLs not yet started when ctx is
+// done are left out of the result.
+func fetchTitlesConcurrently(
+	ctx context.Context,
+	logger logr.Logger,
+	fetcher string,
+	urls []urlRecord,
+	limits ConcurrencyLimits,
+	retries RetryPolicies,
+	fetchTitle func(ctx context.Context, url string) (TitleResult, error),
+) map[string]TitleResult {
+	limits = limits.normalized()
+	logger.V(2).Info("Debug: Starting worker pool", "workers", limits.Global, "perHost", limits.PerHost)
+
+	global := make(chan struct{}, limits.Global)
+	hosts := make(map[string]chan struct{})
+	var mu sync.Mutex
+	results := make(map[string]TitleResult)
+
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		if seen[u.URL] {
+			continue
+		}
+		seen[u.URL] = true
+		rawURL := u.URL
+		host := hostOf(rawURL)
+		if _, ok := hosts[host]; !ok {
+			hosts[host] = make(chan struct{}, limits.PerHost)
+		}
+		hostSlots := hosts[host]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started := false
+			attempt := func(ctx context.Context, url string) (TitleResult, error) {
+				select {
+				case hostSlots <- struct{}{}:
+				case <-ctx.Done():
+					return TitleResult{}, ctx.Err()
+				}
+				defer func() { <-hostSlots }()
+				select {
+				case global <- struct{}{}:
+				case <-ctx.Done():
+					return TitleResult{}, ctx.Err()
+				}
+				defer func() { <-global }()
+				started = true
+				return fetchTitle(ctx, url)
+			}
+
+			start := time.Now()
+			result, err := fetchWithRetries(ctx, logger, retries.For(host), rawURL, attempt)
+			if !started {
+				logger.V(1).Info("Debug: Stopped before fetching", "url", rawURL)
+				return
+			}
+			result.Fetcher = fetcher
+			if result.Duration == 0 {
+				result.Duration = time.Since(start)
+			}
+
+			if err != nil {
+				if ctx.Err() != nil {
+					logger.V(1).Info("Debug: Fetch interrupted", "url", rawURL, "error", err.Error())
+				} else {
+					logger.V(1).Info("Debug: Failed to fetch title", "url", rawURL, "error", err.Error())
+				}
+				result.Title = ""
+				result.Err = err
+			}
+
+			mu.Lock()
+			results[rawURL] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Host
+}
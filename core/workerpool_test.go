@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestFetchTitlesConcurrentlyRespectsPerHostLimit(t *testing.T) {
+	var urls []urlRecord
+	for i := 0; i < 10; i++ {
+		urls = append(urls, newURLRecord(fmt.Sprintf("https://a.example/%d", i)))
+		urls = append(urls, newURLRecord(fmt.Sprintf("https://b.example/%d", i)))
+	}
+	urls = append(urls, urls[0])
+
+	var mu sync.Mutex
+	active := make(map[string]int)
+	maxActive := make(map[string]int)
+
+	fetch := func(ctx context.Context, rawURL string) (TitleResult, error) {
+		host := hostOf(rawURL)
+		mu.Lock()
+		active[host]++
+		if active[host] > maxActive[host] {
+			maxActive[host] = active[host]
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active[host]--
+		mu.Unlock()
+		return TitleResult{Title: "title " + rawURL}, nil
+	}
+
+	results := fetchTitlesConcurrently(context.Background(), testr.New(t), "test", urls, ConcurrencyLimits{Global: 6, PerHost: 2}, RetryPolicies{}, fetch)
+
+	if len(results) != 20 {
+		t.Errorf("got %d results, want 20", len(results))
+	}
+	for _, u := range urls {
+		if results[u.URL].Title != "title "+u.URL {
+			t.Errorf("title for %s = %q", u.URL, results[u.URL].Title)
+		}
+		if results[u.URL].Fetcher != "test" {
+			t.Errorf("fetcher for %s = %q, want %q", u.URL, results[u.URL].Fetcher, "test")
+		}
+	}
+	for host, n := range maxActive {
+		if n > 2 {
+			t.Errorf("host %s had %d concurrent fetches, want at most 2", host, n)
+		}
+	}
+}
+
+func TestFetchTitlesConcurrentlyDoesNotQueueBehindBusyHost(t *testing.T) {
+	var urls []urlRecord
+	for i := 0; i < 10; i++ {
+		urls = append(urls, newURLRecord(fmt.Sprintf("https://a.example/%d", i)))
+	}
+	urls = append(urls, newURLRecord("https://b.example/"))
+
+	unblock := make(chan struct{})
+	fetchedB := make(chan struct{})
+	fetch := func(ctx context.Context, rawURL string) (TitleResult, error) {
+		if hostOf(rawURL) == "b.example" {
+			close(fetchedB)
+		} else {
+			<-unblock
+		}
+		return TitleResult{Title: "title " + rawURL}, nil
+	}
+
+	go func() {
+		select {
+		case <-fetchedB:
+		case <-time.After(time.Second):
+			t.Error("b.example was not fetched while a.example was busy")
+		}
+		close(unblock)
+	}()
+
+	results := fetchTitlesConcurrently(context.Background(), testr.New(t), "test", urls, ConcurrencyLimits{Global: 4, PerHost: 2}, RetryPolicies{}, fetch)
+	if len(results) != len(urls) {
+		t.Errorf("got %d results, want %d", len(results), len(urls))
+	}
+}
+
+func TestFetchTitlesConcurrentlyReleasesSlotsWhileBackingOff(t *testing.T) {
+	urls := []urlRecord{
+		newURLRecord("https://a.example/"),
+		newURLRecord("https://b.example/"),
+	}
+
+	// Whichever URL is fetched first fails once and is retried after a
+	// backoff, during which the other one should get the only slot.
+	var mu sync.Mutex
+	var calls []string
+	fetch := func(ctx context.Context, rawURL string) (TitleResult, error) {
+		mu.Lock()
+		calls = append(calls, rawURL)
+		first := len(calls) == 1
+		mu.Unlock()
+		if first {
+			return TitleResult{}, &HTTPStatusError{URL: rawURL, StatusCode: 503}
+		}
+		return TitleResult{Title: "title " + rawURL}, nil
+	}
+
+	retries := RetryPolicies{Default: RetryPolicy{MaxAttempts: 2, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}}
+	results := fetchTitlesConcurrently(context.Background(), testr.New(t), "test", urls, ConcurrencyLimits{Global: 1}, retries, fetch)
+
+	for _, u := range urls {
+		if results[u.URL].Title != "title "+u.URL {
+			t.Errorf("title for %s = %q", u.URL, results[u.URL].Title)
+		}
+	}
+	if len(calls) != 3 || calls[1] == calls[0] {
+		t.Errorf("fetches = %v, want the other URL fetched during the backoff", calls)
+	}
+}